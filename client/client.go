@@ -0,0 +1,268 @@
+// Package client drives an evm-lab server over HTTP, for Go programs and test suites.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/server"
+)
+
+// Client is a client of an evm-lab server. Its methods are safe for concurrent use, though
+// the server executes one request at a time and rejects the concurrent ones.
+type Client struct {
+	baseURL    string
+	workspace  string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout limits the time of every request, there is no limit by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithHTTPClient sends the requests with httpClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithWorkspace sends the requests to a workspace of the server, the default one otherwise.
+func WithWorkspace(workspace string) Option {
+	return func(c *Client) {
+		c.workspace = workspace
+	}
+}
+
+// New returns a client of the server at baseURL, e.g. http://localhost:8080.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// BaseURL ...
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// Post posts input as json to endpoint, and decodes the response into output.
+// It is there for the endpoints without a method.
+func (c *Client) Post(ctx context.Context, endpoint string, input, output interface{}) (err error) {
+	inputBytes, err := json.Marshal(input)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+endpoint, bytes.NewReader(inputBytes))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.workspace != "" {
+		req.Header.Set(server.WorkspaceHeader, c.workspace)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("API err:%v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		var message struct{ Message string }
+		if json.Unmarshal(respBytes, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(respBytes))
+		}
+		err = fmt.Errorf("API err:%s %s: %s", resp.Status, endpoint, message.Message)
+		return
+	}
+
+	err = json.Unmarshal(respBytes, output)
+	return
+}
+
+// Deploy ...
+func (c *Client) Deploy(ctx context.Context, input lab.DeployInput) (output lab.DeployOutput, err error) {
+	err = c.Post(ctx, server.DeployEndpoint, input, &output)
+	return
+}
+
+// Call ...
+func (c *Client) Call(ctx context.Context, input lab.CallInput) (output lab.CallOutput, err error) {
+	err = c.Post(ctx, server.CallEndpoint, input, &output)
+	return
+}
+
+// StaticCall runs the call without keeping its changes, like eth_call.
+func (c *Client) StaticCall(ctx context.Context, input lab.CallInput) (output lab.CallOutput, err error) {
+	err = c.Post(ctx, server.StaticCallEndpoint, input, &output)
+	return
+}
+
+// SendRawTransaction executes a signed tx in its binary encoding, with the checks of a node.
+func (c *Client) SendRawTransaction(ctx context.Context, tx []byte) (output lab.SendRawTransactionOutput, err error) {
+	err = c.Post(ctx, server.SendRawTransactionEndpoint, lab.SendRawTransactionInput{Tx: tx}, &output)
+	return
+}
+
+// EstimateGas ...
+func (c *Client) EstimateGas(ctx context.Context, input lab.EstimateGasInput) (output lab.EstimateGasOutput, err error) {
+	err = c.Post(ctx, server.EstimateGasEndpoint, input, &output)
+	return
+}
+
+// CreateAccessList ...
+func (c *Client) CreateAccessList(ctx context.Context, input lab.CallInput) (output lab.AccessListOutput, err error) {
+	err = c.Post(ctx, server.AccessListEndpoint, input, &output)
+	return
+}
+
+// GetState returns the balance, nonce and code of addr, with the storage slots given.
+func (c *Client) GetState(ctx context.Context, addr common.Address, slots ...common.Hash) (state lab.AccountState, err error) {
+	var output lab.GetStateOutput
+	err = c.Post(ctx, server.GetStateEndpoint, lab.GetStateInput{Address: addr, Storage: slots}, &output)
+	if err != nil {
+		return
+	}
+	state = output.State
+	return
+}
+
+// Balance ...
+func (c *Client) Balance(ctx context.Context, addr common.Address) (balance *big.Int, err error) {
+	state, err := c.GetState(ctx, addr)
+	if err != nil {
+		return
+	}
+	if state.Balance == nil {
+		err = fmt.Errorf("no balance returned for %s", addr.Hex())
+		return
+	}
+	balance = state.Balance.ToInt()
+	return
+}
+
+// StorageAt ...
+func (c *Client) StorageAt(ctx context.Context, addr common.Address, slot common.Hash) (value common.Hash, err error) {
+	state, err := c.GetState(ctx, addr, slot)
+	if err != nil {
+		return
+	}
+	value = state.Storage[slot]
+	return
+}
+
+// SetState overwrites the fields of an account which are set in input.
+func (c *Client) SetState(ctx context.Context, input lab.SetStateInput) (err error) {
+	var output lab.SetStateOutput
+	err = c.Post(ctx, server.SetStateEndpoint, input, &output)
+	if err == nil && output.ErrMsg != "" {
+		err = fmt.Errorf("setState err:%s", output.ErrMsg)
+	}
+	return
+}
+
+// ChainInfo returns the chain ID and the lab block, for the txs to be signed.
+func (c *Client) ChainInfo(ctx context.Context) (output lab.ChainInfoOutput, err error) {
+	err = c.Post(ctx, server.ChainInfoEndpoint, struct{}{}, &output)
+	return
+}
+
+// ExportState returns the genesis with the current state as its alloc.
+func (c *Client) ExportState(ctx context.Context) (genesis *core.Genesis, err error) {
+	var output lab.ExportStateOutput
+	err = c.Post(ctx, server.ExportStateEndpoint, struct{}{}, &output)
+	if err == nil && output.ErrMsg != "" {
+		err = fmt.Errorf("exportState err:%s", output.ErrMsg)
+	}
+	genesis = output.Genesis
+	return
+}
+
+// ImportState replaces the lab state with the alloc of genesis.
+func (c *Client) ImportState(ctx context.Context, genesis *core.Genesis) (err error) {
+	var output lab.ImportStateOutput
+	err = c.Post(ctx, server.ImportStateEndpoint, lab.ImportStateInput{Genesis: genesis}, &output)
+	if err == nil && output.ErrMsg != "" {
+		err = fmt.Errorf("importState err:%s", output.ErrMsg)
+	}
+	return
+}
+
+// Snapshot saves the lab state, and returns the id to Revert to.
+func (c *Client) Snapshot(ctx context.Context) (id uint64, err error) {
+	var output lab.SnapshotOutput
+	err = c.Post(ctx, server.SnapshotEndpoint, struct{}{}, &output)
+	id = output.ID
+	return
+}
+
+// Revert restores the lab state saved by Snapshot, the snapshot is kept.
+func (c *Client) Revert(ctx context.Context, id uint64) (err error) {
+	var output lab.RevertOutput
+	err = c.Post(ctx, server.RevertEndpoint, lab.RevertInput{ID: id}, &output)
+	if err == nil && output.ErrMsg != "" {
+		err = fmt.Errorf("revert err:%s", output.ErrMsg)
+	}
+	return
+}
+
+// Coverage ...
+func (c *Client) Coverage(ctx context.Context, input lab.CoverageInput) (output lab.CoverageOutput, err error) {
+	err = c.Post(ctx, server.CoverageEndpoint, input, &output)
+	return
+}
+
+// CreateWorkspace creates a workspace from the genesis, or from the state of input.Source.
+func (c *Client) CreateWorkspace(ctx context.Context, input server.WorkspaceCreateInput) (err error) {
+	var output server.WorkspaceOutput
+	err = c.Post(ctx, server.WorkspaceCreateEndpoint, input, &output)
+	if err == nil && output.ErrMsg != "" {
+		err = fmt.Errorf("create workspace err:%s", output.ErrMsg)
+	}
+	return
+}
+
+// DeleteWorkspace ...
+func (c *Client) DeleteWorkspace(ctx context.Context, name string) (err error) {
+	var output server.WorkspaceOutput
+	err = c.Post(ctx, server.WorkspaceDeleteEndpoint, server.WorkspaceDeleteInput{Name: name}, &output)
+	if err == nil && output.ErrMsg != "" {
+		err = fmt.Errorf("delete workspace err:%s", output.ErrMsg)
+	}
+	return
+}
+
+// Workspaces returns the names of the workspaces of the server.
+func (c *Client) Workspaces(ctx context.Context) (names []string, err error) {
+	var output server.WorkspaceListOutput
+	err = c.Post(ctx, server.WorkspaceListEndpoint, struct{}{}, &output)
+	names = output.Names
+	return
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/server"
+	"gotest.tools/assert"
+)
+
+func TestClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case server.SnapshotEndpoint:
+			id := uint64(7)
+			if r.Header.Get(server.WorkspaceHeader) == "alice" {
+				id = 9
+			}
+			json.NewEncoder(w).Encode(lab.SnapshotOutput{ID: id})
+		case server.RevertEndpoint:
+			var input lab.RevertInput
+			json.NewDecoder(r.Body).Decode(&input)
+			json.NewEncoder(w).Encode(lab.RevertOutput{ErrMsg: "snapshot 8 not found"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"message": "no concurrent allowed"})
+		}
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL + "/")
+	ctx := context.Background()
+
+	id, err := c.Snapshot(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, id, uint64(7))
+
+	err = c.Revert(ctx, 8)
+	assert.Assert(t, err != nil && strings.Contains(err.Error(), "snapshot 8 not found"))
+
+	id, err = New(ts.URL, WithWorkspace("alice")).Snapshot(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, id, uint64(9))
+
+	_, err = c.Call(ctx, lab.CallInput{})
+	assert.Assert(t, err != nil && strings.Contains(err.Error(), "no concurrent allowed"))
+}
@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/peterh/liner"
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/wallet"
+)
+
+var clientAccountCmd = cli.Command{
+	Name:  "account",
+	Usage: "manage the accounts of the keystore, which sign the txs of --from",
+	Subcommands: []cli.Command{
+		{
+			Name:   "new",
+			Usage:  "generate a key",
+			Action: accountNew,
+			Flags:  []cli.Flag{flag.KeystoreFlag, flag.PasswordFlag},
+		},
+		{
+			Name:      "import",
+			Usage:     "import the hex private key of a file",
+			ArgsUsage: "<keyfile>",
+			Action:    accountImport,
+			Flags:     []cli.Flag{flag.KeystoreFlag, flag.PasswordFlag},
+		},
+		{
+			Name:   "mnemonic",
+			Usage:  "print a new random mnemonic, for derive or the DevAccounts of the config",
+			Action: accountMnemonic,
+		},
+		{
+			Name:   "derive",
+			Usage:  "import the HD accounts of a mnemonic, which is prompted for",
+			Action: accountDerive,
+			Flags:  []cli.Flag{flag.HDPathFlag, flag.CountFlag, flag.KeystoreFlag, flag.PasswordFlag},
+		},
+		{
+			Name:   "list",
+			Usage:  "list the accounts",
+			Action: accountList,
+			Flags:  []cli.Flag{flag.KeystoreFlag},
+		},
+	},
+}
+
+func openKeystore(ctx *cli.Context) *keystore.KeyStore {
+	return keystore.NewKeyStore(ctx.String(flag.KeystoreFlag.Name), keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
+// readSecret prompts for a secret without echoing it, twice with confirm.
+func readSecret(prompt string, confirm bool) (secret string, err error) {
+	line := liner.NewLiner()
+	defer line.Close()
+
+	secret, err = line.PasswordPrompt(prompt + ": ")
+	if err != nil || !confirm {
+		return
+	}
+	again, err := line.PasswordPrompt("Repeat " + strings.ToLower(prompt) + ": ")
+	if err != nil {
+		return
+	}
+	if again != secret {
+		err = errors.New("the inputs don't match")
+	}
+	return
+}
+
+// keystorePassword reads the file of --password, or prompts for the password.
+func keystorePassword(ctx *cli.Context, confirm bool) (string, error) {
+	file := ctx.String(flag.PasswordFlag.Name)
+	if file == "" {
+		return readSecret("Password", confirm)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func accountNew(ctx *cli.Context) (err error) {
+	password, err := keystorePassword(ctx, true)
+	if err != nil {
+		return
+	}
+	account, err := openKeystore(ctx).NewAccount(password)
+	if err != nil {
+		return
+	}
+	fmt.Println("address", account.Address.Hex())
+	return
+}
+
+func accountImport(ctx *cli.Context) (err error) {
+	if len(ctx.Args()) != 1 {
+		err = fmt.Errorf("exactly one keyfile expected")
+		return
+	}
+	key, err := crypto.LoadECDSA(ctx.Args()[0])
+	if err != nil {
+		return
+	}
+	password, err := keystorePassword(ctx, true)
+	if err != nil {
+		return
+	}
+	account, err := openKeystore(ctx).ImportECDSA(key, password)
+	if err != nil {
+		return
+	}
+	fmt.Println("address", account.Address.Hex())
+	return
+}
+
+func accountMnemonic(ctx *cli.Context) (err error) {
+	mnemonic, err := wallet.NewMnemonic()
+	if err != nil {
+		return
+	}
+	fmt.Println(mnemonic)
+	return
+}
+
+func accountDerive(ctx *cli.Context) (err error) {
+	path, err := accounts.ParseDerivationPath(ctx.String(flag.HDPathFlag.Name))
+	if err != nil {
+		return
+	}
+	mnemonic, err := readSecret("Mnemonic", false)
+	if err != nil {
+		return
+	}
+	keys, err := wallet.DeriveKeys(strings.Join(strings.Fields(mnemonic), " "), "", path, ctx.Int(flag.CountFlag.Name))
+	if err != nil {
+		return
+	}
+	password, err := keystorePassword(ctx, true)
+	if err != nil {
+		return
+	}
+
+	ks := openKeystore(ctx)
+	for i, key := range keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		_, err = ks.ImportECDSA(key, password)
+		switch err {
+		case nil:
+			fmt.Println("address", addr.Hex(), "index", i)
+		case keystore.ErrAccountAlreadyExists:
+			fmt.Println("address", addr.Hex(), "index", i, "exists already")
+			err = nil
+		default:
+			return
+		}
+	}
+	return
+}
+
+func accountList(ctx *cli.Context) (err error) {
+	for _, account := range openKeystore(ctx).Accounts() {
+		fmt.Println(account.Address.Hex(), account.URL.Path)
+	}
+	return
+}
+
+// txSender is the address of --from if set, of --sender otherwise.
+func txSender(ctx *cli.Context) (sender common.Address, err error) {
+	name := flag.TxSenderFlag.Name
+	if ctx.IsSet(flag.FromFlag.Name) {
+		name = flag.FromFlag.Name
+	}
+	if !common.IsHexAddress(ctx.String(name)) {
+		err = fmt.Errorf("invalid --%s:%q, either --sender or --from is required", name, ctx.String(name))
+		return
+	}
+	sender = common.HexToAddress(ctx.String(name))
+	return
+}
+
+// sendSigned signs the deploy or call of input with the keystore account of --from, and sends
+// it as a raw tx. The chain ID and base fee are the ones of the ChainInfo of the server, the nonce
+// is the next one of the account, and the gas limit is estimated unless specified.
+func sendSigned(ctx *cli.Context, input lab.EstimateGasInput) (err error) {
+	if ctx.IsSet(flag.ProfileFlag.Name) || ctx.Bool(flag.StateDiffFlag.Name) {
+		err = fmt.Errorf("--profile and --state_diff are not supported with --from")
+		return
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	var (
+		to              *common.Address
+		data            []byte
+		gas             uint64
+		from            common.Address
+		gasPrice, value *big.Int
+		maxFee, maxTip  *big.Int
+		accessList      types.AccessList
+	)
+	if input.Deploy != nil {
+		d := input.Deploy
+		from, data, gas, gasPrice, value, maxFee, maxTip, accessList = d.Sender, d.CodeAndInput, d.Gas, d.GasPrice, d.Value, d.MaxFeePerGas, d.MaxPriorityFeePerGas, d.AccessList
+	} else {
+		call := input.Call
+		to = &call.Receiver
+		from, data, gas, gasPrice, value, maxFee, maxTip, accessList = call.Sender, call.Input, call.Gas, call.GasPrice, call.Value, call.MaxFeePerGas, call.MaxPriorityFeePerGas, call.AccessList
+	}
+
+	if gas == 0 {
+		var estimate lab.EstimateGasOutput
+		estimate, err = c.EstimateGas(context.Background(), input)
+		if err != nil {
+			return
+		}
+		if estimate.ErrMsg != "" {
+			err = fmt.Errorf("estimate gas err:%s", estimate.ErrMsg)
+			return
+		}
+		gas = estimate.Gas
+	}
+	state, err := c.GetState(context.Background(), from)
+	if err != nil {
+		return
+	}
+	nonce := *state.Nonce
+
+	// the chain of the server, whose config may differ from the local one
+	chain, err := c.ChainInfo(context.Background())
+	if err != nil {
+		return
+	}
+	chainID, baseFee := chain.ChainID, chain.BaseFee
+	if chainID == nil {
+		err = fmt.Errorf("no ChainID in the Genesis.Config of the server")
+		return
+	}
+	// like the wallets, the txs are 1559 ones after london unless a gas price is given
+	if maxFee == nil && maxTip == nil && baseFee != nil && !ctx.IsSet(flag.GasPriceFlag.Name) {
+		maxTip = new(big.Int)
+	}
+	var txData types.TxData
+	switch {
+	case maxFee != nil || maxTip != nil:
+		if maxTip == nil {
+			maxTip = new(big.Int)
+		}
+		if maxFee == nil {
+			if baseFee == nil {
+				err = fmt.Errorf("--max_priority_fee_per_gas needs london")
+				return
+			}
+			// room for the base fee to double
+			maxFee = new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), maxTip)
+		}
+		txData = &types.DynamicFeeTx{ChainID: chainID, Nonce: nonce, GasTipCap: maxTip, GasFeeCap: maxFee, Gas: gas, To: to, Value: value, Data: data, AccessList: accessList}
+	case len(accessList) > 0:
+		txData = &types.AccessListTx{ChainID: chainID, Nonce: nonce, GasPrice: gasPrice, Gas: gas, To: to, Value: value, Data: data, AccessList: accessList}
+	default:
+		txData = &types.LegacyTx{Nonce: nonce, GasPrice: gasPrice, Gas: gas, To: to, Value: value, Data: data}
+	}
+
+	password, err := keystorePassword(ctx, false)
+	if err != nil {
+		return
+	}
+	tx, err := openKeystore(ctx).SignTxWithPassphrase(accounts.Account{Address: from}, password, types.NewTx(txData), chainID)
+	if err != nil {
+		return
+	}
+	txBytes, err := tx.MarshalBinary()
+	if err != nil {
+		return
+	}
+
+	output, err := c.SendRawTransaction(context.Background(), txBytes)
+	if err != nil {
+		return
+	}
+	outputBytes, _ := json.Marshal(output)
+	fmt.Println("output", string(outputBytes))
+	return
+}
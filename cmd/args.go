@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// packArgs packs values as the inputs of a method or constructor, see argValue.
+func packArgs(inputs abi.Arguments, values []interface{}) (packed []byte, err error) {
+	if len(values) != len(inputs) {
+		err = fmt.Errorf("%d args expected, got %d", len(inputs), len(values))
+		return
+	}
+	args := make([]interface{}, len(values))
+	for i, input := range inputs {
+		var v reflect.Value
+		v, err = argValue(input.Type, values[i])
+		if err != nil {
+			err = fmt.Errorf("arg %d: %v", i, err)
+			return
+		}
+		args[i] = v.Interface()
+	}
+	packed, err = inputs.Pack(args...)
+	if err != nil {
+		err = fmt.Errorf("abi.Pack err:%v", err)
+	}
+	return
+}
+
+// argValue converts v to the go type of t. v is the text of a value, or a number, or a list
+// for arrays and tuples. Integers can be decimal or 0x prefixed hex, bytes are 0x prefixed hex,
+// and the fixed bytes shorter than their size are right padded with zeros.
+func argValue(t abi.Type, v interface{}) (reflect.Value, error) {
+	switch t.T {
+	case abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		items, ok := v.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("list expected for %s, got %v", t, v)
+		}
+		return listValue(t, items)
+	}
+
+	s := fmt.Sprint(v)
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		x, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("invalid %s: %s", t, s)
+		}
+		if max, min := intRange(t); x.Cmp(max) > 0 || x.Cmp(min) < 0 {
+			return reflect.Value{}, fmt.Errorf("%s out of range: %s", t, s)
+		}
+		return intValue(t, x), nil
+	case abi.BoolTy:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid bool: %s", s)
+		}
+		return reflect.ValueOf(b), nil
+	case abi.StringTy:
+		return reflect.ValueOf(s), nil
+	case abi.AddressTy:
+		if !common.IsHexAddress(s) {
+			return reflect.Value{}, fmt.Errorf("invalid address: %s", s)
+		}
+		return reflect.ValueOf(common.HexToAddress(s)), nil
+	case abi.BytesTy:
+		data, err := hexutil.Decode(s)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid bytes %s: %v", s, err)
+		}
+		return reflect.ValueOf(data), nil
+	case abi.FixedBytesTy:
+		data, err := hexutil.Decode(s)
+		if err != nil || len(data) > t.Size {
+			return reflect.Value{}, fmt.Errorf("invalid %s: %s", t, s)
+		}
+		fixed := reflect.New(t.GetType()).Elem()
+		reflect.Copy(fixed, reflect.ValueOf(data))
+		return fixed, nil
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func listValue(t abi.Type, items []interface{}) (v reflect.Value, err error) {
+	switch t.T {
+	case abi.SliceTy:
+		v = reflect.MakeSlice(t.GetType(), len(items), len(items))
+	case abi.ArrayTy:
+		if len(items) != t.Size {
+			err = fmt.Errorf("%d items expected for %s, got %d", t.Size, t, len(items))
+			return
+		}
+		v = reflect.New(t.GetType()).Elem()
+	default:
+		if len(items) != len(t.TupleElems) {
+			err = fmt.Errorf("%d items expected for %s, got %d", len(t.TupleElems), t, len(items))
+			return
+		}
+		v = reflect.New(t.GetType()).Elem()
+		for i, elem := range t.TupleElems {
+			var field reflect.Value
+			field, err = argValue(*elem, items[i])
+			if err != nil {
+				return
+			}
+			v.Field(i).Set(field)
+		}
+		return
+	}
+
+	for i := range items {
+		var elem reflect.Value
+		elem, err = argValue(*t.Elem, items[i])
+		if err != nil {
+			return
+		}
+		v.Index(i).Set(elem)
+	}
+	return
+}
+
+// valueString is the text of a value unpacked by abi, as accepted by argValue.
+func valueString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return formatValue(reflect.ValueOf(v))
+}
+
+// sameValue compares the texts of two values, as numbers when they both are, so that
+// 0x prefixed hex and addresses match whatever their case and padding.
+func sameValue(expected, actual string) bool {
+	if expected == actual {
+		return true
+	}
+	x, okX := new(big.Int).SetString(expected, 0)
+	y, okY := new(big.Int).SetString(actual, 0)
+	return okX && okY && x.Cmp(y) == 0
+}
@@ -2,24 +2,31 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"math/big"
-	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/compiler"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/client"
 	"github.com/zhiqiangxu/evm-lab/cmd/flag"
 	"github.com/zhiqiangxu/evm-lab/config"
+	"github.com/zhiqiangxu/evm-lab/lab"
 	"github.com/zhiqiangxu/evm-lab/server"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
 )
 
 // ClientCmd ...
@@ -29,6 +36,20 @@ var ClientCmd = cli.Command{
 	Subcommands: []cli.Command{
 		clientDeployCmd,
 		clientCallCmd,
+		clientAccessListCmd,
+		clientEstimateCmd,
+		clientDebugCmd,
+		clientTraceCmd,
+		clientFuzzCmd,
+		clientInvariantCmd,
+		clientCoverageCmd,
+		clientRunCmd,
+		clientReplCmd,
+		clientWorkspaceCmd,
+		clientExportCmd,
+		clientImportCmd,
+		clientSendRawCmd,
+		clientAccountCmd,
 		clientModSolcVersionCmd,
 	},
 }
@@ -38,13 +59,25 @@ var clientDeployCmd = cli.Command{
 	Usage:  "trigger deploy action",
 	Action: clientDeploy,
 	Flags: []cli.Flag{
-		flag.SenderFlag,
+		flag.TxSenderFlag,
+		flag.FromFlag,
+		flag.KeystoreFlag,
+		flag.PasswordFlag,
 		flag.SolcFlag,
 		flag.ContractPathFlag,
 		flag.GasFlag,
 		flag.GasPriceFlag,
+		flag.MaxFeePerGasFlag,
+		flag.MaxPriorityFeePerGasFlag,
+		flag.AccessListFlag,
 		flag.ValueFlag,
+		flag.ProfileFlag,
+		flag.StateDiffFlag,
 		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
 	},
 }
 
@@ -53,15 +86,53 @@ var clientCallCmd = cli.Command{
 	Usage:  "trigger call action",
 	Action: clientCall,
 	Flags: []cli.Flag{
-		flag.SenderFlag,
+		flag.TxSenderFlag,
+		flag.FromFlag,
+		flag.KeystoreFlag,
+		flag.PasswordFlag,
 		flag.SolcFlag,
 		flag.ReceiverFlag,
 		flag.ContractPathFlag,
 		flag.MethodFlag,
 		flag.GasFlag,
 		flag.GasPriceFlag,
+		flag.MaxFeePerGasFlag,
+		flag.MaxPriorityFeePerGasFlag,
+		flag.AccessListFlag,
 		flag.ValueFlag,
+		flag.ProfileFlag,
+		flag.StateDiffFlag,
 		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+var clientAccessListCmd = cli.Command{
+	Name:   "access-list",
+	Usage:  "generate the optimal access list of a call",
+	Action: clientAccessList,
+	Flags:  clientCallCmd.Flags,
+}
+
+var clientEstimateCmd = cli.Command{
+	Name:  "estimate",
+	Usage: "estimate the minimum gas limit of a deploy or call",
+	Subcommands: []cli.Command{
+		{
+			Name:   "deploy",
+			Usage:  "estimate gas of a deploy",
+			Action: clientEstimateDeploy,
+			Flags:  clientDeployCmd.Flags,
+		},
+		{
+			Name:   "call",
+			Usage:  "estimate gas of a call",
+			Action: clientEstimateCall,
+			Flags:  clientCallCmd.Flags,
+		},
 	},
 }
 
@@ -76,111 +147,105 @@ var clientModSolcVersionCmd = cli.Command{
 }
 
 func clientDeploy(ctx *cli.Context) (err error) {
-
-	// type DeployInput struct {
-	// 	Sender       common.Address
-	// 	CodeAndInput []byte
-	// 	Gas          uint64
-	// 	GasPrice     *big.Int
-	// 	Value        *big.Int
-	// }
-
-	sender := common.HexToAddress(ctx.String(flag.SenderFlag.Name))
-	contracts, err := compiler.CompileSolidity(ctx.String(flag.SolcFlag.Name), ctx.String(flag.ContractPathFlag.Name))
+	input, err := buildDeployInput(ctx)
 	if err != nil {
-		utils.Fatalf("CompileSolidity err: %v", err)
+		return
 	}
-	contractFileName := filepath.Base(ctx.String(flag.ContractPathFlag.Name))
-
-	var (
-		contract    *compiler.Contract
-		contractABI abi.ABI
-	)
-	for name, c := range contracts {
-		nameParts := strings.Split(name, ":")
-		if strings.ToLower(nameParts[len(nameParts)-1])+".sol" != strings.ToLower(contractFileName) {
-			continue
-		}
-
-		if contract != nil {
-			utils.Fatalf("Multiple contracts filtered.")
-		}
-		contract = c
-		abiBytes, _ := json.Marshal(contract.Info.AbiDefinition)
-		contractABI, err = abi.JSON(strings.NewReader(string(abiBytes)))
-		if err != nil {
-			err = fmt.Errorf("abi.JSON err:%v", err)
-			return
-		}
+	if ctx.IsSet(flag.FromFlag.Name) {
+		return sendSigned(ctx, lab.EstimateGasInput{Deploy: &input})
 	}
 
-	var args []interface{}
-	for _, arg := range ctx.Args() {
-		args = append(args, arg)
+	var output lab.DeployOutput
+	err = postServer(ctx, server.DeployEndpoint, input, &output)
+	if err != nil {
+		return
 	}
-	var inputBin []byte
-	if len(args) > 0 {
-		inputBin, err = contractABI.Pack("", args...)
+	if output.Profile != nil {
+		err = writeProfile(ctx.String(flag.ProfileFlag.Name), output.Profile)
 		if err != nil {
-			err = fmt.Errorf("abi.Pack err:%v", err)
 			return
 		}
+		output.Profile = nil
+	}
+	if output.StateDiff != nil {
+		printStateDiff(output.StateDiff)
+		output.StateDiff = nil
 	}
 
-	if contract == nil {
-		err = fmt.Errorf("contract not found")
+	outputBytes, _ := json.Marshal(output)
+	fmt.Println("output", string(outputBytes))
+	return
+}
+
+func clientCall(ctx *cli.Context) (err error) {
+	input, err := buildCallInput(ctx)
+	if err != nil {
 		return
 	}
-	codeAndInput := append(common.FromHex(contract.Code), inputBin...)
+	if ctx.IsSet(flag.FromFlag.Name) {
+		return sendSigned(ctx, lab.EstimateGasInput{Call: &input})
+	}
 
-	gas := ctx.Uint64(flag.GasFlag.Name)
-	gasPrice, ok := big.NewInt(0).SetString(ctx.String(flag.GasPriceFlag.Name), 10)
-	if !ok {
-		err = fmt.Errorf("invalid gas price:%s", ctx.String(flag.GasPriceFlag.Name))
+	var output lab.CallOutput
+	err = postServer(ctx, server.CallEndpoint, input, &output)
+	if err != nil {
 		return
 	}
-	value, ok := big.NewInt(0).SetString(ctx.String(flag.ValueFlag.Name), 10)
-	if !ok {
-		err = fmt.Errorf("invalid value:%s", ctx.String(flag.ValueFlag.Name))
-		return
+	if output.Profile != nil {
+		err = writeProfile(ctx.String(flag.ProfileFlag.Name), output.Profile)
+		if err != nil {
+			return
+		}
+		output.Profile = nil
 	}
-
-	input := server.DeployInput{
-		Sender:       sender,
-		CodeAndInput: codeAndInput,
-		Gas:          gas,
-		GasPrice:     gasPrice,
-		Value:        value,
+	if output.StateDiff != nil {
+		printStateDiff(output.StateDiff)
+		output.StateDiff = nil
 	}
 
-	file := ctx.String(flag.ConfigFlag.Name)
-	confBytes, err := ioutil.ReadFile(file)
+	outputBytes, _ := json.Marshal(output)
+	fmt.Println("output", string(outputBytes))
+	return
+}
+
+func clientAccessList(ctx *cli.Context) (err error) {
+	input, err := buildCallInput(ctx)
 	if err != nil {
-		err = fmt.Errorf("config file not found:%s", file)
 		return
 	}
 
-	var conf config.Config
-	err = json.Unmarshal(confBytes, &conf)
+	var output lab.AccessListOutput
+	err = postServer(ctx, server.AccessListEndpoint, input, &output)
 	if err != nil {
 		return
 	}
 
-	inputBytes, _ := json.Marshal(input)
-	resp, err := http.Post(fmt.Sprintf("http://localhost:%d%s", conf.Port, server.DeployEndpoint), "application/json", bytes.NewBuffer(inputBytes))
+	outputBytes, _ := json.Marshal(output)
+	fmt.Println("output", string(outputBytes))
+	return
+}
+
+func clientEstimateDeploy(ctx *cli.Context) (err error) {
+	input, err := buildDeployInput(ctx)
 	if err != nil {
-		err = fmt.Errorf("API err:%v", err)
 		return
 	}
-	defer resp.Body.Close()
 
-	respBytes, err := ioutil.ReadAll(resp.Body)
+	return clientEstimate(ctx, lab.EstimateGasInput{Deploy: &input})
+}
+
+func clientEstimateCall(ctx *cli.Context) (err error) {
+	input, err := buildCallInput(ctx)
 	if err != nil {
 		return
 	}
 
-	var output server.DeployOutput
-	err = json.Unmarshal(respBytes, &output)
+	return clientEstimate(ctx, lab.EstimateGasInput{Call: &input})
+}
+
+func clientEstimate(ctx *cli.Context, input lab.EstimateGasInput) (err error) {
+	var output lab.EstimateGasOutput
+	err = postServer(ctx, server.EstimateGasEndpoint, input, &output)
 	if err != nil {
 		return
 	}
@@ -190,29 +255,38 @@ func clientDeploy(ctx *cli.Context) (err error) {
 	return
 }
 
-func clientCall(ctx *cli.Context) (err error) {
+// compiledContract is a contract compiled by solc, along with its source files.
+type compiledContract struct {
+	Name     string
+	Contract *compiler.Contract
+	ABI      abi.ABI
+	Sources  []srcmap.Source
+}
 
-	// type CallInput struct {
-	// 	Input    []byte
-	// 	Gas      uint64
-	// 	Sender   common.Address
-	// 	Receiver common.Address
-	// 	GasPrice *big.Int
-	// 	Value    *big.Int
-	// }
+func (c *compiledContract) artifact() *srcmap.Artifact {
+	srcMap, _ := c.Contract.Info.SrcMap.(string)
+	return &srcmap.Artifact{
+		Name:          c.Name,
+		SrcMap:        srcMap,
+		SrcMapRuntime: c.Contract.Info.SrcMapRuntime,
+		Sources:       c.Sources,
+	}
+}
 
-	sender := common.HexToAddress(ctx.String(flag.SenderFlag.Name))
-	receiver := common.HexToAddress(ctx.String(flag.ReceiverFlag.Name))
-	contracts, err := compiler.CompileSolidity(ctx.String(flag.SolcFlag.Name), ctx.String(flag.ContractPathFlag.Name))
+// compileContract compiles contract_path and picks the contract named after the file.
+func compileContract(ctx *cli.Context) (contract *compiledContract, err error) {
+	return compileContractFile(ctx.String(flag.SolcFlag.Name), ctx.String(flag.ContractPathFlag.Name))
+}
+
+// compileContractFile compiles path and picks the contract named after the file.
+func compileContractFile(solc, path string) (contract *compiledContract, err error) {
+	contracts, sources, err := compileSolidity(solc, path)
 	if err != nil {
-		utils.Fatalf("CompileSolidity err: %v", err)
+		err = fmt.Errorf("CompileSolidity err: %v", err)
+		return
 	}
-	contractFileName := filepath.Base(ctx.String(flag.ContractPathFlag.Name))
+	contractFileName := filepath.Base(path)
 
-	var (
-		contract    *compiler.Contract
-		contractABI abi.ABI
-	)
 	for name, c := range contracts {
 		nameParts := strings.Split(name, ":")
 		if strings.ToLower(nameParts[len(nameParts)-1])+".sol" != strings.ToLower(contractFileName) {
@@ -220,17 +294,94 @@ func clientCall(ctx *cli.Context) (err error) {
 		}
 
 		if contract != nil {
-			utils.Fatalf("Multiple contracts filtered.")
+			err = fmt.Errorf("multiple contracts filtered")
+			return
 		}
-		contract = c
-		abiBytes, _ := json.Marshal(contract.Info.AbiDefinition)
-		contractABI, err = abi.JSON(strings.NewReader(string(abiBytes)))
+		contract = &compiledContract{Name: nameParts[len(nameParts)-1], Contract: c, Sources: sources}
+		abiBytes, _ := json.Marshal(c.Info.AbiDefinition)
+		contract.ABI, err = abi.JSON(strings.NewReader(string(abiBytes)))
 		if err != nil {
 			err = fmt.Errorf("abi.JSON err:%v", err)
 			return
 		}
 	}
 
+	if contract == nil {
+		err = fmt.Errorf("contract not found")
+	}
+	return
+}
+
+func buildDeployInput(ctx *cli.Context) (input lab.DeployInput, err error) {
+	sender, err := txSender(ctx)
+	if err != nil {
+		return
+	}
+	contract, err := compileContract(ctx)
+	if err != nil {
+		return
+	}
+
+	var args []interface{}
+	for _, arg := range ctx.Args() {
+		args = append(args, arg)
+	}
+	var inputBin []byte
+	if len(args) > 0 {
+		inputBin, err = contract.ABI.Pack("", args...)
+		if err != nil {
+			err = fmt.Errorf("abi.Pack err:%v", err)
+			return
+		}
+	}
+
+	codeAndInput := append(common.FromHex(contract.Contract.Code), inputBin...)
+
+	gas := ctx.Uint64(flag.GasFlag.Name)
+	gasPrice, ok := big.NewInt(0).SetString(ctx.String(flag.GasPriceFlag.Name), 10)
+	if !ok {
+		err = fmt.Errorf("invalid gas price:%s", ctx.String(flag.GasPriceFlag.Name))
+		return
+	}
+	value, ok := big.NewInt(0).SetString(ctx.String(flag.ValueFlag.Name), 10)
+	if !ok {
+		err = fmt.Errorf("invalid value:%s", ctx.String(flag.ValueFlag.Name))
+		return
+	}
+	maxFee, maxTip, accessList, err := parseFeeFlags(ctx)
+	if err != nil {
+		return
+	}
+
+	input = lab.DeployInput{
+		Sender:       sender,
+		CodeAndInput: codeAndInput,
+		Gas:          gas,
+		GasPrice:     gasPrice,
+		Value:        value,
+
+		MaxFeePerGas:         maxFee,
+		MaxPriorityFeePerGas: maxTip,
+		AccessList:           accessList,
+
+		Artifact:  contract.artifact(),
+		Profile:   ctx.IsSet(flag.ProfileFlag.Name),
+		StateDiff: ctx.Bool(flag.StateDiffFlag.Name),
+	}
+	return
+}
+
+func buildCallInput(ctx *cli.Context) (input lab.CallInput, err error) {
+	sender, err := txSender(ctx)
+	if err != nil {
+		return
+	}
+	receiver := common.HexToAddress(ctx.String(flag.ReceiverFlag.Name))
+	contract, err := compileContract(ctx)
+	if err != nil {
+		return
+	}
+
 	var args []interface{}
 	for _, arg := range ctx.Args() {
 		if strings.HasPrefix(arg, "0x") {
@@ -241,7 +392,7 @@ func clientCall(ctx *cli.Context) (err error) {
 
 	}
 
-	inputBin, err := contractABI.Pack(ctx.String(flag.MethodFlag.Name), args...)
+	inputBin, err := contract.ABI.Pack(ctx.String(flag.MethodFlag.Name), args...)
 	if err != nil {
 		err = fmt.Errorf("abi.Pack err:%v", err)
 		return
@@ -258,16 +409,31 @@ func clientCall(ctx *cli.Context) (err error) {
 		err = fmt.Errorf("invalid value:%s", ctx.String(flag.ValueFlag.Name))
 		return
 	}
+	maxFee, maxTip, accessList, err := parseFeeFlags(ctx)
+	if err != nil {
+		return
+	}
 
-	input := server.CallInput{
+	input = lab.CallInput{
 		Sender:   sender,
 		Receiver: receiver,
 		Input:    inputBin,
 		Gas:      gas,
 		GasPrice: gasPrice,
 		Value:    value,
+
+		MaxFeePerGas:         maxFee,
+		MaxPriorityFeePerGas: maxTip,
+		AccessList:           accessList,
+
+		Profile:   ctx.IsSet(flag.ProfileFlag.Name),
+		StateDiff: ctx.Bool(flag.StateDiffFlag.Name),
 	}
+	return
+}
 
+// loadConfig reads the config file specified by cfg.
+func loadConfig(ctx *cli.Context) (conf config.Config, err error) {
 	file := ctx.String(flag.ConfigFlag.Name)
 	confBytes, err := ioutil.ReadFile(file)
 	if err != nil {
@@ -275,33 +441,205 @@ func clientCall(ctx *cli.Context) (err error) {
 		return
 	}
 
-	var conf config.Config
 	err = json.Unmarshal(confBytes, &conf)
+	return
+}
+
+// loadClientConfig reads the client config file, which may be missing unless specified.
+func loadClientConfig(ctx *cli.Context) (conf config.ClientConfig, err error) {
+	file := ctx.String(flag.ClientConfigFlag.Name)
+	confBytes, err := ioutil.ReadFile(file)
 	if err != nil {
+		if os.IsNotExist(err) && !ctx.IsSet(flag.ClientConfigFlag.Name) {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("client config file not found:%s", file)
 		return
 	}
 
-	inputBytes, _ := json.Marshal(input)
-	resp, err := http.Post(fmt.Sprintf("http://localhost:%d%s", conf.Port, server.CallEndpoint), "application/json", bytes.NewBuffer(inputBytes))
+	err = json.Unmarshal(confBytes, &conf)
+	return
+}
+
+// labEnv returns the lab server to target, with the workspace flag overriding the workspace of the env.
+func labEnv(ctx *cli.Context) (env config.Env, err error) {
+	env, err = serverEnv(ctx)
 	if err != nil {
-		err = fmt.Errorf("API err:%v", err)
 		return
 	}
-	defer resp.Body.Close()
+	if workspace := ctx.String(flag.WorkspaceFlag.Name); workspace != "" {
+		env.Workspace = workspace
+	}
+	return
+}
 
-	respBytes, err := ioutil.ReadAll(resp.Body)
+// serverEnv returns the server flag, the env flag or the default env of the client config,
+// or the local server of cfg.
+func serverEnv(ctx *cli.Context) (env config.Env, err error) {
+	if serverURL := ctx.String(flag.ServerFlag.Name); serverURL != "" {
+		env.Server, err = normalizeServerURL(serverURL)
+		return
+	}
+
+	clientConf, err := loadClientConfig(ctx)
 	if err != nil {
 		return
 	}
+	name := ctx.String(flag.EnvFlag.Name)
+	if name == "" {
+		name = clientConf.Default
+	}
+	if name != "" {
+		var ok bool
+		env, ok = clientConf.Envs[name]
+		if !ok {
+			err = fmt.Errorf("env %s not found in %s", name, ctx.String(flag.ClientConfigFlag.Name))
+			return
+		}
+		env.Server, err = normalizeServerURL(env.Server)
+		return
+	}
 
-	var output server.CallOutput
-	err = json.Unmarshal(respBytes, &output)
+	conf, err := loadConfig(ctx)
 	if err != nil {
 		return
 	}
+	env.Server = fmt.Sprintf("http://localhost:%d", conf.Port)
+	return
+}
 
-	outputBytes, _ := json.Marshal(output)
-	fmt.Println("output", string(outputBytes))
+// normalizeServerURL defaults the scheme of server to http, and drops the trailing slash.
+func normalizeServerURL(server string) (_ string, err error) {
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		err = fmt.Errorf("invalid server url:%q", server)
+		return
+	}
+	return strings.TrimSuffix(server, "/"), nil
+}
+
+// newClient returns a client of the lab server of labEnv.
+func newClient(ctx *cli.Context) (c *client.Client, err error) {
+	env, err := labEnv(ctx)
+	if err != nil {
+		return
+	}
+
+	var opts []client.Option
+	if env.Workspace != "" {
+		opts = append(opts, client.WithWorkspace(env.Workspace))
+	}
+	if env.Timeout > 0 {
+		opts = append(opts, client.WithTimeout(time.Duration(env.Timeout)*time.Second))
+	}
+	c = client.New(env.Server, opts...)
+	return
+}
+
+// postServer posts input to endpoint of the lab server, and decodes the response into output.
+func postServer(ctx *cli.Context, endpoint string, input, output interface{}) (err error) {
+	c, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	err = c.Post(context.Background(), endpoint, input, output)
+	return
+}
+
+// writeProfile writes the folded stacks to prefix.folded, and the rest as json to prefix.json.
+func writeProfile(prefix string, profile *lab.GasProfile) (err error) {
+	folded := strings.Join(profile.Folded, "\n") + "\n"
+	err = ioutil.WriteFile(prefix+".folded", []byte(folded), 0644)
+	if err != nil {
+		return
+	}
+
+	profile.Folded = nil
+	profileBytes, _ := json.MarshalIndent(profile, "", "  ")
+	err = ioutil.WriteFile(prefix+".json", profileBytes, 0644)
+	if err != nil {
+		return
+	}
+
+	fmt.Printf("gas profile written to %s.folded and %s.json\n", prefix, prefix)
+	return
+}
+
+// printStateDiff prints the changes of every account, sorted by address.
+func printStateDiff(diff *lab.StateDiff) {
+	var addrs []common.Address
+	for addr := range diff.Post {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+
+	fmt.Println("state diff:")
+	for _, addr := range addrs {
+		pre, post := diff.Pre[addr], diff.Post[addr]
+		fmt.Println(addr.Hex())
+		if post.Balance != nil {
+			fmt.Printf("  balance: %s -> %s\n", pre.Balance.ToInt(), post.Balance.ToInt())
+		}
+		if post.Nonce != nil {
+			fmt.Printf("  nonce: %d -> %d\n", *pre.Nonce, *post.Nonce)
+		}
+		if pre.Code != nil || post.Code != nil {
+			fmt.Printf("  code: %d bytes -> %d bytes\n", len(pre.Code), len(post.Code))
+		}
+
+		var slots []common.Hash
+		for slot := range post.Storage {
+			slots = append(slots, slot)
+		}
+		sort.Slice(slots, func(i, j int) bool { return bytes.Compare(slots[i][:], slots[j][:]) < 0 })
+		for _, slot := range slots {
+			fmt.Printf("  storage %s: %s -> %s\n", slot.Hex(), pre.Storage[slot].Hex(), post.Storage[slot].Hex())
+		}
+	}
+}
+
+// parseFeeFlags parses the optional EIP-1559 fee caps and EIP-2930 access list.
+func parseFeeFlags(ctx *cli.Context) (maxFee, maxTip *big.Int, accessList types.AccessList, err error) {
+	if ctx.IsSet(flag.MaxFeePerGasFlag.Name) {
+		var ok bool
+		maxFee, ok = big.NewInt(0).SetString(ctx.String(flag.MaxFeePerGasFlag.Name), 10)
+		if !ok {
+			err = fmt.Errorf("invalid max fee per gas:%s", ctx.String(flag.MaxFeePerGasFlag.Name))
+			return
+		}
+	}
+	if ctx.IsSet(flag.MaxPriorityFeePerGasFlag.Name) {
+		var ok bool
+		maxTip, ok = big.NewInt(0).SetString(ctx.String(flag.MaxPriorityFeePerGasFlag.Name), 10)
+		if !ok {
+			err = fmt.Errorf("invalid max priority fee per gas:%s", ctx.String(flag.MaxPriorityFeePerGasFlag.Name))
+			return
+		}
+	}
+
+	// the access list is either inline json or a path to a json file
+	accessListJSON := strings.TrimSpace(ctx.String(flag.AccessListFlag.Name))
+	if accessListJSON == "" {
+		return
+	}
+	if !strings.HasPrefix(accessListJSON, "[") {
+		var content []byte
+		content, err = ioutil.ReadFile(accessListJSON)
+		if err != nil {
+			err = fmt.Errorf("access list file not found:%s", accessListJSON)
+			return
+		}
+		accessListJSON = string(content)
+	}
+	err = json.Unmarshal([]byte(accessListJSON), &accessList)
+	if err != nil {
+		err = fmt.Errorf("invalid access list:%v", err)
+	}
 	return
 }
 
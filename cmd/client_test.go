@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestNormalizeServerURL(t *testing.T) {
+	for server, expected := range map[string]string{
+		"localhost:8080":          "http://localhost:8080",
+		"http://10.0.0.2:8080/":   "http://10.0.0.2:8080",
+		"https://lab.example.com": "https://lab.example.com",
+	} {
+		normalized, err := normalizeServerURL(server)
+		assert.NilError(t, err)
+		assert.Equal(t, normalized, expected)
+	}
+
+	for _, invalid := range []string{"ftp://lab.example.com", "http://", "http://[::1"} {
+		_, err := normalizeServerURL(invalid)
+		assert.Assert(t, err != nil, invalid)
+	}
+}
+
+func TestParseBreakpoint(t *testing.T) {
+	bp, err := parseBreakpoint("0x1a")
+	assert.NilError(t, err)
+	assert.Equal(t, *bp.PC, uint64(0x1a))
+
+	bp, err = parseBreakpoint("Token.sol:42")
+	assert.NilError(t, err)
+	assert.Equal(t, bp.File, "Token.sol")
+	assert.Equal(t, bp.Line, 42)
+
+	bp, err = parseBreakpoint("sstore")
+	assert.NilError(t, err)
+	assert.Equal(t, bp.Op, "SSTORE")
+
+	_, err = parseBreakpoint("SSTOR")
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/server"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+var clientCoverageCmd = cli.Command{
+	Name:   "coverage",
+	Usage:  "write the coverage of the deploys and calls so far as LCOV and HTML, the server should run with Coverage set in the config",
+	Action: clientCoverage,
+	Flags: []cli.Flag{
+		flag.LCOVFlag,
+		flag.HTMLFlag,
+		flag.ResetFlag,
+		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+func clientCoverage(ctx *cli.Context) (err error) {
+	var output lab.CoverageOutput
+	err = postServer(ctx, server.CoverageEndpoint, lab.CoverageInput{Reset: ctx.Bool(flag.ResetFlag.Name)}, &output)
+	if err != nil {
+		return
+	}
+	if len(output.Files) == 0 {
+		err = fmt.Errorf("no coverage, is Coverage set in the config of the server?")
+		return
+	}
+
+	return writeCoverage(output.Files, ctx.String(flag.LCOVFlag.Name), ctx.String(flag.HTMLFlag.Name))
+}
+
+// fileSummary counts the lines and branch directions of a file, found and hit.
+type fileSummary struct {
+	*srcmap.FileCoverage
+	lines                      []int
+	linesHit                   int
+	branchesFound, branchesHit int
+}
+
+func summarize(file *srcmap.FileCoverage) *fileSummary {
+	summary := &fileSummary{FileCoverage: file}
+	for line, count := range file.Lines {
+		summary.lines = append(summary.lines, line)
+		if count > 0 {
+			summary.linesHit++
+		}
+	}
+	sort.Ints(summary.lines)
+	for _, branch := range file.Branches {
+		summary.branchesFound += 2
+		if branch.Taken > 0 {
+			summary.branchesHit++
+		}
+		if branch.NotTaken > 0 {
+			summary.branchesHit++
+		}
+	}
+	return summary
+}
+
+func percent(hit, found int) string {
+	if found == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%.1f%%)", hit, found, float64(hit)*100/float64(found))
+}
+
+// writeCoverage prints a summary of files, and writes them as LCOV to lcovPath and HTML to htmlPath,
+// either of which can be empty.
+func writeCoverage(files []*srcmap.FileCoverage, lcovPath, htmlPath string) (err error) {
+	var summaries []*fileSummary
+	for _, file := range files {
+		summaries = append(summaries, summarize(file))
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].File < summaries[j].File })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "File\tLines\tBranches")
+	for _, summary := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", summary.File, percent(summary.linesHit, len(summary.lines)), percent(summary.branchesHit, summary.branchesFound))
+	}
+	w.Flush()
+
+	if lcovPath != "" {
+		err = writeLCOV(lcovPath, summaries)
+		if err != nil {
+			return
+		}
+		fmt.Println("LCOV written to", lcovPath)
+	}
+	if htmlPath != "" {
+		err = writeCoverageHTML(htmlPath, summaries)
+		if err != nil {
+			return
+		}
+		fmt.Println("HTML written to", htmlPath)
+	}
+	return
+}
+
+func writeLCOV(path string, summaries []*fileSummary) (err error) {
+	var b strings.Builder
+	for _, summary := range summaries {
+		fmt.Fprintf(&b, "TN:\nSF:%s\n", summary.File)
+		for _, line := range summary.lines {
+			fmt.Fprintf(&b, "DA:%d,%d\n", line, summary.Lines[line])
+		}
+		for i, branch := range summary.Branches {
+			// branch 0 is the jump, 1 the fall through, - when the JUMPI was never reached
+			if branch.Taken+branch.NotTaken == 0 {
+				fmt.Fprintf(&b, "BRDA:%d,%d,0,-\nBRDA:%d,%d,1,-\n", branch.Line, i, branch.Line, i)
+				continue
+			}
+			fmt.Fprintf(&b, "BRDA:%d,%d,0,%d\nBRDA:%d,%d,1,%d\n", branch.Line, i, branch.Taken, branch.Line, i, branch.NotTaken)
+		}
+		fmt.Fprintf(&b, "BRF:%d\nBRH:%d\nLF:%d\nLH:%d\nend_of_record\n", summary.branchesFound, summary.branchesHit, len(summary.lines), summary.linesHit)
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
+
+var coverageHTML = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>evm lab coverage</title>
+<style>
+body { font-family: sans-serif; }
+table.summary td, table.summary th { padding: 2px 12px; text-align: left; }
+table.source { border-collapse: collapse; font-family: monospace; white-space: pre; }
+table.source td { padding: 0 8px; }
+td.number, td.count { color: #888; text-align: right; }
+tr.hit td.code { background: #dfd; }
+tr.missed td.code { background: #fdd; }
+tr.partial td.code { background: #ffc; }
+</style>
+</head>
+<body>
+<h1>Coverage</h1>
+<table class="summary">
+<tr><th>File</th><th>Lines</th><th>Branches</th></tr>
+{{range .}}<tr><td><a href="#{{.Anchor}}">{{.File}}</a></td><td>{{.Lines}}</td><td>{{.Branches}}</td></tr>
+{{end}}</table>
+{{range .}}
+<h2 id="{{.Anchor}}">{{.File}}</h2>
+<table class="source">
+{{range .Rows}}<tr class="{{.Class}}"><td class="number">{{.Number}}</td><td class="count">{{.Count}}</td><td class="code">{{.Code}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+type coverageHTMLRow struct {
+	Number int
+	Count  string
+	// hit, missed, partial when some branch of the line was never taken, empty without code
+	Class string
+	Code  string
+}
+
+type coverageHTMLFile struct {
+	File     string
+	Anchor   string
+	Lines    string
+	Branches string
+	Rows     []coverageHTMLRow
+}
+
+func writeCoverageHTML(path string, summaries []*fileSummary) (err error) {
+	var files []coverageHTMLFile
+	for i, summary := range summaries {
+		// lines with a branch direction never taken
+		partial := make(map[int]bool)
+		for _, branch := range summary.Branches {
+			if branch.Taken == 0 || branch.NotTaken == 0 {
+				partial[branch.Line] = true
+			}
+		}
+
+		file := coverageHTMLFile{
+			File:     summary.File,
+			Anchor:   fmt.Sprintf("file%d", i),
+			Lines:    percent(summary.linesHit, len(summary.lines)),
+			Branches: percent(summary.branchesHit, summary.branchesFound),
+		}
+		for j, code := range strings.Split(summary.Content, "\n") {
+			row := coverageHTMLRow{Number: j + 1, Code: code}
+			if count, ok := summary.Lines[row.Number]; ok {
+				row.Count = fmt.Sprint(count)
+				switch {
+				case count == 0:
+					row.Class = "missed"
+				case partial[row.Number]:
+					row.Class = "partial"
+				default:
+					row.Class = "hit"
+				}
+			}
+			file.Rows = append(file.Rows, row)
+		}
+		files = append(files, file)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return coverageHTML.Execute(f, files)
+}
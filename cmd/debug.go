@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/server"
+)
+
+var clientDebugCmd = cli.Command{
+	Name:  "debug",
+	Usage: "step through a deploy or call, on a copy of the lab state",
+	Subcommands: []cli.Command{
+		{
+			Name:   "deploy",
+			Usage:  "debug a deploy",
+			Action: clientDebugDeploy,
+			Flags:  clientDeployCmd.Flags,
+		},
+		{
+			Name:   "call",
+			Usage:  "debug a call",
+			Action: clientDebugCall,
+			Flags:  clientCallCmd.Flags,
+		},
+	},
+}
+
+func clientDebugDeploy(ctx *cli.Context) (err error) {
+	input, err := buildDeployInput(ctx)
+	if err != nil {
+		return
+	}
+
+	return clientDebug(ctx, lab.DebugStartInput{Deploy: &input})
+}
+
+func clientDebugCall(ctx *cli.Context) (err error) {
+	input, err := buildCallInput(ctx)
+	if err != nil {
+		return
+	}
+
+	return clientDebug(ctx, lab.DebugStartInput{Call: &input})
+}
+
+const debugHelp = `commands:
+  s, step               execute one instruction
+  n, next               execute one instruction, stepping over sub calls
+  o, out                run until the current call returns
+  c, continue           run until a breakpoint is hit
+  b <pc|OPCODE|[file:]line>
+                        add a breakpoint, e.g. b 0x1a, b SSTORE, b Token.sol:42
+  bl                    list breakpoints
+  d [index]             delete a breakpoint, or all of them
+  stack, mem, storage, bt
+                        show the stack, memory, accessed storage, or call stack
+  q, stop               abort the execution
+  an empty line repeats the last command`
+
+func clientDebug(ctx *cli.Context, input lab.DebugStartInput) (err error) {
+	var output lab.DebugOutput
+	err = postServer(ctx, server.DebugStartEndpoint, input, &output)
+	if err != nil {
+		return
+	}
+
+	var (
+		breakpoints []lab.Breakpoint
+		// added since the last command, dropped if the server rejects them
+		pending int
+		// the last state, kept when a command is rejected
+		state  *lab.DebugState
+		last   string
+		reader = bufio.NewReader(os.Stdin)
+	)
+	fmt.Println(debugHelp)
+	for {
+		if output.Done || output.Session == "" {
+			outputBytes, _ := json.Marshal(output)
+			fmt.Println("output", string(outputBytes))
+			return
+		}
+		if output.ErrMsg != "" {
+			fmt.Println("error:", output.ErrMsg)
+			if pending > 0 {
+				breakpoints = breakpoints[:len(breakpoints)-pending]
+				fmt.Printf("%d new breakpoints dropped\n", pending)
+			}
+		}
+		pending = 0
+		if output.State != nil {
+			state = output.State
+			printDebugState(state)
+		}
+
+		var command string
+	prompt:
+		for {
+			fmt.Print("(debug) ")
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				// stdin closed
+				line = "stop"
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				line = last
+			}
+			last = line
+
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "s", "step":
+				command = lab.DebugStep
+			case "n", "next":
+				command = lab.DebugNext
+			case "o", "out":
+				command = lab.DebugOut
+			case "c", "continue":
+				command = lab.DebugContinue
+			case "q", "stop":
+				command = lab.DebugStop
+			case "b":
+				if len(fields) != 2 {
+					fmt.Println("usage: b <pc|OPCODE|[file:]line>")
+					continue
+				}
+				bp, err := parseBreakpoint(fields[1])
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				breakpoints = append(breakpoints, bp)
+				pending++
+				last = ""
+			case "bl":
+				for i, bp := range breakpoints {
+					fmt.Printf("%d: %s\n", i, formatBreakpoint(bp))
+				}
+			case "d":
+				if len(fields) == 1 {
+					breakpoints, pending = nil, 0
+					continue
+				}
+				i, err := strconv.Atoi(fields[1])
+				if err != nil || i < 0 || i >= len(breakpoints) {
+					fmt.Println("invalid breakpoint index")
+					continue
+				}
+				if i >= len(breakpoints)-pending {
+					pending--
+				}
+				breakpoints = append(breakpoints[:i], breakpoints[i+1:]...)
+				last = ""
+			case "stack", "mem", "storage", "bt":
+				if state == nil {
+					fmt.Println("no state yet")
+					continue
+				}
+				printDebugDetail(fields[0], state)
+			case "h", "help":
+				fmt.Println(debugHelp)
+			default:
+				fmt.Printf("unknown command %q, h for help\n", fields[0])
+			}
+			if command != "" {
+				break prompt
+			}
+		}
+
+		// breakpoints are always sent, so that they reflect the local list
+		if breakpoints == nil {
+			breakpoints = []lab.Breakpoint{}
+		}
+		input := lab.DebugCommandInput{Session: output.Session, Command: command, Breakpoints: breakpoints}
+		// a rejected command has no State, which must not be left over from the previous output
+		output = lab.DebugOutput{}
+		err = postServer(ctx, server.DebugCommandEndpoint, input, &output)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// printDebugDetail prints the stack, mem, storage or bt of state.
+func printDebugDetail(what string, state *lab.DebugState) {
+	switch what {
+	case "stack":
+		for i := len(state.Stack) - 1; i >= 0; i-- {
+			fmt.Printf("%4d  %s\n", len(state.Stack)-i-1, state.Stack[i])
+		}
+	case "mem":
+		fmt.Print(hex.Dump(state.Memory))
+	case "storage":
+		for slot, value := range state.Storage {
+			fmt.Printf("%s: %s\n", slot.Hex(), value.Hex())
+		}
+	case "bt":
+		for i := len(state.CallStack) - 1; i >= 0; i-- {
+			frame := state.CallStack[i]
+			fmt.Printf("#%d %s %s from %s", i, frame.Type, frame.Contract, frame.From.Hex())
+			if frame.Location != nil {
+				fmt.Printf(" at %s", frame.Location)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func printDebugState(state *lab.DebugState) {
+	if state.Location != nil {
+		fmt.Println(state.Location)
+		if state.Location.Snippet != "" {
+			fmt.Println("    " + state.Location.Snippet)
+		}
+	}
+	fmt.Printf("[depth %d] pc=%d %s gas=%d cost=%d", state.Depth, state.PC, state.Op, state.Gas, state.Cost)
+	if n := len(state.Stack); n > 0 {
+		fmt.Printf(" top=%s", state.Stack[n-1])
+	}
+	fmt.Println()
+}
+
+// parseBreakpoint parses a 0x prefixed pc, a [file:]line, or an opcode.
+func parseBreakpoint(s string) (bp lab.Breakpoint, err error) {
+	if strings.HasPrefix(s, "0x") {
+		pc, err := strconv.ParseUint(s[2:], 16, 64)
+		if err != nil {
+			return bp, fmt.Errorf("invalid pc %q", s)
+		}
+		bp.PC = &pc
+		return bp, nil
+	}
+
+	file, lineStr := "", s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		file, lineStr = s[:i], s[i+1:]
+	}
+	if line, err := strconv.Atoi(lineStr); err == nil {
+		bp.File, bp.Line = file, line
+		return bp, nil
+	}
+
+	if _, err = lab.ParseOp(s); err != nil {
+		return
+	}
+	bp.Op = strings.ToUpper(s)
+	return bp, nil
+}
+
+func formatBreakpoint(bp lab.Breakpoint) string {
+	switch {
+	case bp.PC != nil:
+		return fmt.Sprintf("pc 0x%x", *bp.PC)
+	case bp.Op != "":
+		return "op " + bp.Op
+	case bp.File != "":
+		return fmt.Sprintf("line %s:%d", bp.File, bp.Line)
+	default:
+		return fmt.Sprintf("line %d", bp.Line)
+	}
+}
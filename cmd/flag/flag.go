@@ -12,11 +12,75 @@ var ConfigFlag = cli.StringFlag{
 	Value: config.ConfigJSON,
 }
 
+// ServerFlag ...
+var ServerFlag = cli.StringFlag{
+	Name:   "server",
+	Usage:  "url of the lab server, e.g. http://10.0.0.2:8080, instead of the env or the port of cfg",
+	EnvVar: "EVM_LAB_SERVER",
+}
+
+// EnvFlag ...
+var EnvFlag = cli.StringFlag{
+	Name:   "env",
+	Usage:  "name of the lab server in the client config, the default env of the client config otherwise",
+	EnvVar: "EVM_LAB_ENV",
+}
+
+// WorkspaceFlag ...
+var WorkspaceFlag = cli.StringFlag{
+	Name:   "workspace",
+	Usage:  "workspace of the lab server, instead of the one of the env",
+	EnvVar: "EVM_LAB_WORKSPACE",
+}
+
+// SourceFlag ...
+var SourceFlag = cli.StringFlag{
+	Name:  "source",
+	Usage: "workspace to copy the state of, the genesis otherwise",
+}
+
+// SnapshotFlag ...
+var SnapshotFlag = cli.Uint64Flag{
+	Name:  "snapshot",
+	Usage: "snapshot id of the source workspace to copy, its current state by default",
+}
+
+// ForkChaindataFlag ...
+var ForkChaindataFlag = cli.StringFlag{
+	Name:  "fork_chaindata",
+	Usage: "geth chaindata directory to fork the lab state from, e.g. <datadir>/geth/chaindata",
+}
+
+// ForkDumpFlag ...
+var ForkDumpFlag = cli.StringFlag{
+	Name:  "fork_dump",
+	Usage: "file of geth dump to fork the lab state from",
+}
+
+// ForkBlockFlag ...
+var ForkBlockFlag = cli.Uint64Flag{
+	Name:  "fork_block",
+	Usage: "block of the chaindata to fork from, the head by default",
+}
+
+// OutputFlag ...
+var OutputFlag = cli.StringFlag{
+	Name:  "output",
+	Usage: "file to write, stdout by default",
+}
+
+// ClientConfigFlag ...
+var ClientConfigFlag = cli.StringFlag{
+	Name:   "client_cfg",
+	Usage:  "client config file, with the lab servers by env name, optional unless specified",
+	Value:  config.ClientConfigJSON,
+	EnvVar: "EVM_LAB_CLIENT_CFG",
+}
+
 // GasFlag ...
 var GasFlag = cli.Uint64Flag{
 	Name:  "gas",
-	Usage: "gas limit for tx",
-	Value: 10000000000,
+	Usage: "gas limit for tx, defaults to the block gas limit",
 }
 
 // GasPriceFlag ...
@@ -26,6 +90,24 @@ var GasPriceFlag = cli.StringFlag{
 	Value: "0",
 }
 
+// MaxFeePerGasFlag ...
+var MaxFeePerGasFlag = cli.StringFlag{
+	Name:  "max_fee_per_gas",
+	Usage: "EIP-1559 max fee per gas for tx",
+}
+
+// MaxPriorityFeePerGasFlag ...
+var MaxPriorityFeePerGasFlag = cli.StringFlag{
+	Name:  "max_priority_fee_per_gas",
+	Usage: "EIP-1559 max priority fee per gas for tx",
+}
+
+// AccessListFlag ...
+var AccessListFlag = cli.StringFlag{
+	Name:  "access_list",
+	Usage: "EIP-2930 access list for tx, inline json or path of a json file",
+}
+
 var SolcFlag = cli.StringFlag{
 	Name:  "solc",
 	Usage: "solc path",
@@ -38,6 +120,125 @@ var ValueFlag = cli.StringFlag{
 	Value: "0",
 }
 
+// ProfileFlag ...
+var ProfileFlag = cli.StringFlag{
+	Name:  "profile",
+	Usage: "collect a gas profile, written to <profile>.folded and <profile>.json",
+}
+
+// StateDiffFlag ...
+var StateDiffFlag = cli.BoolFlag{
+	Name:  "state_diff",
+	Usage: "print the accounts and storage slots changed by the tx",
+}
+
+// MatchFlag ...
+var MatchFlag = cli.StringFlag{
+	Name:  "match",
+	Usage: "only run the test functions matching the regexp",
+}
+
+// MethodsFlag ...
+var MethodsFlag = cli.StringFlag{
+	Name:  "methods",
+	Usage: "comma separated methods to fuzz, all of them by default",
+}
+
+// PropertyFlag ...
+var PropertyFlag = cli.StringFlag{
+	Name:  "property",
+	Usage: "prefix of the property functions, which take no input and return true while the property holds",
+	Value: "property",
+}
+
+// RunsFlag ...
+var RunsFlag = cli.IntFlag{
+	Name:  "runs",
+	Usage: "number of random inputs per method, or of call sequences for invariant",
+	Value: 256,
+}
+
+// DepthFlag ...
+var DepthFlag = cli.IntFlag{
+	Name:  "depth",
+	Usage: "number of calls per sequence",
+	Value: 15,
+}
+
+// SendersFlag ...
+var SendersFlag = cli.StringFlag{
+	Name:  "senders",
+	Usage: "comma separated senders of the calls, the genesis accounts by default",
+}
+
+// SeedFlag ...
+var SeedFlag = cli.Int64Flag{
+	Name:  "seed",
+	Usage: "seed of the random inputs, random by default",
+}
+
+// FailOnRevertFlag ...
+var FailOnRevertFlag = cli.BoolFlag{
+	Name:  "fail_on_revert",
+	Usage: "report every revert, not only the panics and the errors other than revert",
+}
+
+// LCOVFlag ...
+var LCOVFlag = cli.StringFlag{
+	Name:  "lcov",
+	Usage: "path of the LCOV coverage report, empty for none",
+	Value: "lcov.info",
+}
+
+// HTMLFlag ...
+var HTMLFlag = cli.StringFlag{
+	Name:  "html",
+	Usage: "path of the HTML coverage report, empty for none",
+	Value: "coverage.html",
+}
+
+// ResetFlag ...
+var ResetFlag = cli.BoolFlag{
+	Name:  "reset",
+	Usage: "clear the coverage of the server once written",
+}
+
+// CoverageFlag ...
+var CoverageFlag = cli.BoolFlag{
+	Name:  "coverage",
+	Usage: "write the coverage of the contracts under test, see lcov and html",
+}
+
+// OpsFlag ...
+var OpsFlag = cli.StringFlag{
+	Name:  "ops",
+	Usage: "comma separated opcodes to trace, all of them by default",
+}
+
+// MinDepthFlag ...
+var MinDepthFlag = cli.IntFlag{
+	Name:  "min_depth",
+	Usage: "min call depth to trace, the tx itself is at depth 1",
+}
+
+// MaxDepthFlag ...
+var MaxDepthFlag = cli.IntFlag{
+	Name:  "max_depth",
+	Usage: "max call depth to trace, 0 means no limit",
+}
+
+// AddressesFlag ...
+var AddressesFlag = cli.StringFlag{
+	Name:  "addresses",
+	Usage: "comma separated contract addresses to trace, all of them by default",
+}
+
+// StackFlag ...
+var StackFlag = cli.BoolFlag{
+	Name:  "stack",
+	Usage: "include the stack in the traced steps",
+}
+
 // ContractPathFlag ...
 var ContractPathFlag = cli.StringFlag{
 	Name:     "contract_path",
@@ -59,6 +260,46 @@ var SenderFlag = cli.StringFlag{
 	Required: true,
 }
 
+// TxSenderFlag is SenderFlag for the commands which can sign with FromFlag instead
+var TxSenderFlag = cli.StringFlag{
+	Name:  "sender",
+	Usage: "sender of tx, the address of --from if not set",
+}
+
+// FromFlag ...
+var FromFlag = cli.StringFlag{
+	Name:  "from",
+	Usage: "address of a keystore account signing the tx, which is executed like a raw tx",
+}
+
+// KeystoreFlag ...
+var KeystoreFlag = cli.StringFlag{
+	Name:   "keystore",
+	Usage:  "directory of the encrypted keys",
+	Value:  "keystore",
+	EnvVar: "EVM_LAB_KEYSTORE",
+}
+
+// PasswordFlag ...
+var PasswordFlag = cli.StringFlag{
+	Name:  "password",
+	Usage: "file with the password of the keystore, prompted otherwise",
+}
+
+// HDPathFlag ...
+var HDPathFlag = cli.StringFlag{
+	Name:  "hd_path",
+	Usage: "derivation path of the first account, the following ones incrementing its last component",
+	Value: "m/44'/60'/0'/0/0",
+}
+
+// CountFlag ...
+var CountFlag = cli.IntFlag{
+	Name:  "count",
+	Usage: "number of accounts to derive",
+	Value: 1,
+}
+
 // ReceiverFlag ...
 var ReceiverFlag = cli.StringFlag{
 	Name:  "receiver",
@@ -0,0 +1,670 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/server"
+)
+
+var clientFuzzCmd = cli.Command{
+	Name:   "fuzz",
+	Usage:  "call the methods of a deployed contract with random inputs, on snapshots of the lab state",
+	Action: clientFuzz,
+	Flags: []cli.Flag{
+		flag.SenderFlag,
+		flag.SolcFlag,
+		flag.ReceiverFlag,
+		flag.ContractPathFlag,
+		flag.MethodsFlag,
+		flag.PropertyFlag,
+		flag.RunsFlag,
+		flag.SeedFlag,
+		flag.FailOnRevertFlag,
+		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+const (
+	// max number of candidates tried when shrinking a failing input
+	maxShrinks = 1000
+	// max length of the generated dynamic arrays, bytes and strings, except for the edge cases
+	maxFuzzLen = 8
+)
+
+// panicSelector is the selector of Panic(uint256), raised by assert and the checked arithmetic.
+var panicSelector = common.FromHex("0x4e487b71")
+
+var panicReasons = map[uint64]string{
+	0x01: "assertion failed",
+	0x11: "arithmetic overflow",
+	0x12: "division by zero",
+	0x21: "invalid enum value",
+	0x22: "invalid storage byte array",
+	0x31: "pop on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to zero function",
+}
+
+type fuzzer struct {
+	ctx          *cli.Context
+	rand         *rand.Rand
+	sender       common.Address
+	receiver     common.Address
+	properties   []abi.Method
+	failOnRevert bool
+	snapshot     uint64
+	// the generated addresses are often picked from these, to hit the access checks
+	addresses []common.Address
+}
+
+func clientFuzz(ctx *cli.Context) (err error) {
+	if !common.IsHexAddress(ctx.String(flag.ReceiverFlag.Name)) {
+		err = fmt.Errorf("receiver of the deployed contract is required")
+		return
+	}
+	contract, err := compileContract(ctx)
+	if err != nil {
+		return
+	}
+
+	seed := fuzzSeed(ctx)
+	f := &fuzzer{
+		ctx:          ctx,
+		rand:         rand.New(rand.NewSource(seed)),
+		sender:       common.HexToAddress(ctx.String(flag.SenderFlag.Name)),
+		receiver:     common.HexToAddress(ctx.String(flag.ReceiverFlag.Name)),
+		failOnRevert: ctx.Bool(flag.FailOnRevertFlag.Name),
+	}
+	f.addresses = []common.Address{{}, f.sender, f.receiver}
+
+	methods, err := f.selectMethods(contract.ABI, splitList(ctx.String(flag.MethodsFlag.Name)), ctx.String(flag.PropertyFlag.Name))
+	if err != nil {
+		return
+	}
+
+	err = f.takeSnapshot()
+	if err != nil {
+		return
+	}
+	// the lab state is left as it was
+	defer func() {
+		if revertErr := f.revert(); err == nil {
+			err = revertErr
+		}
+	}()
+
+	fmt.Printf("fuzzing %d methods of %s with %d properties, seed %d\n", len(methods), contract.Name, len(f.properties), seed)
+
+	// the properties must hold before fuzzing, or every input would break them
+	err = f.revert()
+	if err != nil {
+		return
+	}
+	reason, err := f.checkProperties()
+	if err != nil {
+		return
+	}
+	if reason != "" {
+		err = fmt.Errorf("%s before fuzzing", reason)
+		return
+	}
+
+	var failed int
+	for _, method := range methods {
+		var failures int
+		failures, err = f.fuzzMethod(method, ctx.Int(flag.RunsFlag.Name))
+		if err != nil {
+			return
+		}
+		failed += failures
+	}
+
+	if failed > 0 {
+		err = fmt.Errorf("%d failing inputs found, seed %d", failed, seed)
+	}
+	return
+}
+
+// selectMethods returns the methods to fuzz, sorted by name, and collects the properties.
+func (f *fuzzer) selectMethods(contractABI abi.ABI, names []string, propertyPrefix string) (methods []abi.Method, err error) {
+	for _, method := range contractABI.Methods {
+		if propertyPrefix != "" && strings.HasPrefix(method.Name, propertyPrefix) {
+			err = checkPropertyMethod(method)
+			if err != nil {
+				return
+			}
+			f.properties = append(f.properties, method)
+			continue
+		}
+		if len(names) > 0 && !containsString(names, method.Name) {
+			continue
+		}
+		if !fuzzable(method.Inputs) {
+			fmt.Printf("skipping %s, unsupported input type\n", method.Sig)
+			continue
+		}
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Sig < methods[j].Sig })
+	sort.Slice(f.properties, func(i, j int) bool { return f.properties[i].Name < f.properties[j].Name })
+
+	for _, name := range names {
+		if _, ok := contractABI.Methods[name]; !ok {
+			err = fmt.Errorf("method %s not found", name)
+			return
+		}
+	}
+	if len(methods) == 0 {
+		err = fmt.Errorf("no method to fuzz")
+	}
+	return
+}
+
+// checkPropertyMethod checks that method can be a property, or an invariant.
+func checkPropertyMethod(method abi.Method) error {
+	if len(method.Inputs) > 0 || len(method.Outputs) != 1 || method.Outputs[0].Type.T != abi.BoolTy {
+		return fmt.Errorf("%s should take no input and return a bool", method.Name)
+	}
+	return nil
+}
+
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzMethod calls method with runs random inputs, and prints the distinct failing inputs once shrunk.
+func (f *fuzzer) fuzzMethod(method abi.Method, runs int) (failures int, err error) {
+	if len(method.Inputs) == 0 {
+		// nothing to randomize
+		runs = 1
+	}
+
+	reported := make(map[string]bool)
+	for i := 0; i < runs; i++ {
+		args := make([]reflect.Value, len(method.Inputs))
+		for j, input := range method.Inputs {
+			args[j] = f.generate(input.Type)
+		}
+
+		var reason string
+		reason, err = f.check(method, args)
+		if err != nil {
+			return
+		}
+		if reason == "" {
+			continue
+		}
+
+		args, reason, err = f.shrink(method, args, reason)
+		if err != nil {
+			return
+		}
+		call := formatCall(method, args)
+		if reported[call] {
+			continue
+		}
+		reported[call] = true
+		failures++
+		fmt.Printf("[FAIL. Reason: %s] %s\n", reason, call)
+	}
+
+	if failures == 0 {
+		fmt.Printf("[PASS] %s (runs: %d)\n", method.Sig, runs)
+	}
+	return
+}
+
+// fuzzSeed returns the seed flag, a random seed if it is not set.
+func fuzzSeed(ctx *cli.Context) int64 {
+	if ctx.IsSet(flag.SeedFlag.Name) {
+		return ctx.Int64(flag.SeedFlag.Name)
+	}
+	return time.Now().UnixNano()
+}
+
+// takeSnapshot saves the lab state, which revert restores.
+func (f *fuzzer) takeSnapshot() (err error) {
+	var output lab.SnapshotOutput
+	err = postServer(f.ctx, server.SnapshotEndpoint, struct{}{}, &output)
+	f.snapshot = output.ID
+	return
+}
+
+func (f *fuzzer) revert() (err error) {
+	var output lab.RevertOutput
+	err = postServer(f.ctx, server.RevertEndpoint, lab.RevertInput{ID: f.snapshot}, &output)
+	if err != nil {
+		return
+	}
+	if output.ErrMsg != "" {
+		err = fmt.Errorf("revert err:%s", output.ErrMsg)
+	}
+	return
+}
+
+func (f *fuzzer) call(method abi.Method, args []interface{}) (output lab.CallOutput, err error) {
+	return f.callFrom(f.sender, f.receiver, method, args)
+}
+
+func (f *fuzzer) callFrom(sender, receiver common.Address, method abi.Method, args []interface{}) (output lab.CallOutput, err error) {
+	packed, err := method.Inputs.Pack(args...)
+	if err != nil {
+		err = fmt.Errorf("abi.Pack err:%v", err)
+		return
+	}
+	input := lab.CallInput{
+		Sender:   sender,
+		Receiver: receiver,
+		Input:    append(append([]byte{}, method.ID...), packed...),
+	}
+	err = postServer(f.ctx, server.CallEndpoint, input, &output)
+	return
+}
+
+// check runs method with args on the snapshot, and returns why it failed, empty if it didn't.
+func (f *fuzzer) check(method abi.Method, args []reflect.Value) (reason string, err error) {
+	err = f.revert()
+	if err != nil {
+		return
+	}
+
+	values := make([]interface{}, len(args))
+	for i := range args {
+		values[i] = args[i].Interface()
+	}
+	output, err := f.call(method, values)
+	if err != nil {
+		return
+	}
+	if output.ErrMsg != "" {
+		reason = f.unexpectedRevert(output)
+		return
+	}
+	return f.checkProperties()
+}
+
+// unexpectedRevert returns the reason of a failed call, empty if the revert is expected, like a failed require.
+func (f *fuzzer) unexpectedRevert(output lab.CallOutput) string {
+	if bytes.HasPrefix(output.Result, panicSelector) && len(output.Result) == 4+32 {
+		code := new(big.Int).SetBytes(output.Result[4:]).Uint64()
+		if reason, ok := panicReasons[code]; ok {
+			return fmt.Sprintf("panic 0x%02x (%s)", code, reason)
+		}
+		return fmt.Sprintf("panic 0x%02x", code)
+	}
+	if !strings.HasPrefix(output.ErrMsg, "Error:"+vm.ErrExecutionReverted.Error()) || f.failOnRevert {
+		return output.ErrMsg
+	}
+	return ""
+}
+
+// checkProperties returns the first property which is broken in the current state, empty if none.
+func (f *fuzzer) checkProperties() (reason string, err error) {
+	for _, property := range f.properties {
+		reason, err = f.checkProperty(f.receiver, property)
+		if err != nil || reason != "" {
+			return
+		}
+	}
+	return
+}
+
+// checkProperty calls property on receiver, and returns why it is broken, empty if it holds.
+func (f *fuzzer) checkProperty(receiver common.Address, property abi.Method) (reason string, err error) {
+	output, err := f.callFrom(f.sender, receiver, property, nil)
+	if err != nil {
+		return
+	}
+	if output.ErrMsg != "" {
+		reason = fmt.Sprintf("%s reverted: %s", property.Name, output.ErrMsg)
+		return
+	}
+	values, unpackErr := property.Outputs.Unpack(output.Result)
+	if unpackErr != nil || len(values) != 1 {
+		reason = fmt.Sprintf("%s returned 0x%x", property.Name, output.Result)
+		return
+	}
+	if holds, _ := values[0].(bool); !holds {
+		reason = fmt.Sprintf("%s broken", property.Name)
+	}
+	return
+}
+
+// shrink simplifies the failing args one candidate at a time, as long as they keep failing.
+func (f *fuzzer) shrink(method abi.Method, args []reflect.Value, reason string) (_ []reflect.Value, _ string, err error) {
+	for attempts := 0; attempts < maxShrinks; {
+		shrunk := false
+		for i := 0; i < len(args) && !shrunk && attempts < maxShrinks; i++ {
+			for _, candidate := range shrinkValue(method.Inputs[i].Type, args[i]) {
+				attempts++
+				candidateArgs := append([]reflect.Value{}, args...)
+				candidateArgs[i] = candidate
+
+				var candidateReason string
+				candidateReason, err = f.check(method, candidateArgs)
+				if err != nil {
+					return
+				}
+				if candidateReason != "" {
+					args, reason, shrunk = candidateArgs, candidateReason, true
+					break
+				}
+				if attempts >= maxShrinks {
+					break
+				}
+			}
+		}
+		if !shrunk {
+			break
+		}
+	}
+	return args, reason, nil
+}
+
+// fuzzable tells whether random values can be generated for all of args.
+func fuzzable(args abi.Arguments) bool {
+	var supported func(t abi.Type) bool
+	supported = func(t abi.Type) bool {
+		switch t.T {
+		case abi.IntTy, abi.UintTy, abi.BoolTy, abi.StringTy, abi.BytesTy, abi.FixedBytesTy, abi.AddressTy:
+			return true
+		case abi.SliceTy, abi.ArrayTy:
+			return supported(*t.Elem)
+		case abi.TupleTy:
+			for _, elem := range t.TupleElems {
+				if !supported(*elem) {
+					return false
+				}
+			}
+			return true
+		default:
+			return false
+		}
+	}
+	for _, arg := range args {
+		if !supported(arg.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// generate returns a random value of t, as packed by abi.Arguments, edge cases included.
+func (f *fuzzer) generate(t abi.Type) reflect.Value {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		return intValue(t, f.generateInt(t))
+	case abi.BoolTy:
+		return reflect.ValueOf(f.rand.Intn(2) == 1)
+	case abi.StringTy:
+		data := f.generateBytes()
+		for i := range data {
+			// printable ascii
+			data[i] = ' ' + data[i]%95
+		}
+		return reflect.ValueOf(string(data))
+	case abi.BytesTy:
+		return reflect.ValueOf(f.generateBytes())
+	case abi.FixedBytesTy:
+		v := reflect.New(t.GetType()).Elem()
+		if f.rand.Intn(4) > 0 {
+			for i := 0; i < t.Size; i++ {
+				v.Index(i).SetUint(uint64(f.rand.Intn(256)))
+			}
+		}
+		return v
+	case abi.AddressTy:
+		if f.rand.Intn(2) == 0 {
+			return reflect.ValueOf(f.addresses[f.rand.Intn(len(f.addresses))])
+		}
+		var addr common.Address
+		f.rand.Read(addr[:])
+		return reflect.ValueOf(addr)
+	case abi.SliceTy:
+		n := f.rand.Intn(maxFuzzLen + 1)
+		v := reflect.MakeSlice(t.GetType(), n, n)
+		for i := 0; i < n; i++ {
+			v.Index(i).Set(f.generate(*t.Elem))
+		}
+		return v
+	case abi.ArrayTy:
+		v := reflect.New(t.GetType()).Elem()
+		for i := 0; i < t.Size; i++ {
+			v.Index(i).Set(f.generate(*t.Elem))
+		}
+		return v
+	case abi.TupleTy:
+		v := reflect.New(t.GetType()).Elem()
+		for i, elem := range t.TupleElems {
+			v.Field(i).Set(f.generate(*elem))
+		}
+		return v
+	default:
+		panic(fmt.Sprintf("unsupported type %s", t))
+	}
+}
+
+// generateInt returns an edge case half of the time, otherwise a random integer
+// of random bit length, so that the small values are as likely as the large ones.
+func (f *fuzzer) generateInt(t abi.Type) *big.Int {
+	max, min := intRange(t)
+	if f.rand.Intn(2) == 0 {
+		edges := []*big.Int{big.NewInt(0), big.NewInt(1), max, new(big.Int).Sub(max, big.NewInt(1))}
+		if min.Sign() < 0 {
+			edges = append(edges, big.NewInt(-1), min, new(big.Int).Add(min, big.NewInt(1)))
+		}
+		return edges[f.rand.Intn(len(edges))]
+	}
+
+	bits := 1 + f.rand.Intn(max.BitLen())
+	x := new(big.Int).Rand(f.rand, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	if min.Sign() < 0 && f.rand.Intn(2) == 0 {
+		x.Neg(x)
+		if x.Cmp(min) < 0 {
+			x.Set(min)
+		}
+	}
+	return x
+}
+
+// intRange returns the bounds of an integer type.
+func intRange(t abi.Type) (max, min *big.Int) {
+	if t.T == abi.UintTy {
+		max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(t.Size)), big.NewInt(1))
+		min = big.NewInt(0)
+		return
+	}
+	max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1)), big.NewInt(1))
+	min = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1)))
+	return
+}
+
+// generateBytes returns empty, short, or occasionally longer than a word random bytes.
+func (f *fuzzer) generateBytes() []byte {
+	var n int
+	switch f.rand.Intn(4) {
+	case 0:
+	case 1:
+		n = 33 + f.rand.Intn(64)
+	default:
+		n = f.rand.Intn(maxFuzzLen + 1)
+	}
+	data := make([]byte, n)
+	f.rand.Read(data)
+	return data
+}
+
+// intValue converts x to the go type of t, which is *big.Int above 64 bits.
+func intValue(t abi.Type, x *big.Int) reflect.Value {
+	typ := t.GetType()
+	if typ == reflect.TypeOf(x) {
+		return reflect.ValueOf(new(big.Int).Set(x))
+	}
+	v := reflect.New(typ).Elem()
+	if t.T == abi.IntTy {
+		v.SetInt(x.Int64())
+	} else {
+		v.SetUint(x.Uint64())
+	}
+	return v
+}
+
+func bigValue(v reflect.Value) *big.Int {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(v.Uint())
+	default:
+		return new(big.Int).Set(v.Interface().(*big.Int))
+	}
+}
+
+// shrinkValue returns simpler candidates for v, the simplest first.
+func shrinkValue(t abi.Type, v reflect.Value) (candidates []reflect.Value) {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		for _, x := range shrinkInt(bigValue(v)) {
+			candidates = append(candidates, intValue(t, x))
+		}
+	case abi.BoolTy:
+		if v.Bool() {
+			candidates = append(candidates, reflect.ValueOf(false))
+		}
+	case abi.StringTy, abi.BytesTy:
+		if n := v.Len(); n > 0 {
+			candidates = append(candidates, v.Slice(0, 0), v.Slice(0, n/2))
+			if n > 1 {
+				candidates = append(candidates, v.Slice(0, n-1))
+			}
+		}
+	case abi.FixedBytesTy, abi.AddressTy:
+		if !v.IsZero() {
+			candidates = append(candidates, reflect.Zero(v.Type()))
+		}
+	case abi.SliceTy:
+		n := v.Len()
+		if n > 0 {
+			candidates = append(candidates, v.Slice(0, 0), v.Slice(0, n/2))
+			if n > 1 {
+				candidates = append(candidates, v.Slice(0, n-1))
+			}
+		}
+		for i := 0; i < n; i++ {
+			for _, elem := range shrinkValue(*t.Elem, v.Index(i)) {
+				c := reflect.MakeSlice(v.Type(), n, n)
+				reflect.Copy(c, v)
+				c.Index(i).Set(elem)
+				candidates = append(candidates, c)
+			}
+		}
+	case abi.ArrayTy:
+		for i := 0; i < v.Len(); i++ {
+			for _, elem := range shrinkValue(*t.Elem, v.Index(i)) {
+				c := reflect.New(v.Type()).Elem()
+				c.Set(v)
+				c.Index(i).Set(elem)
+				candidates = append(candidates, c)
+			}
+		}
+	case abi.TupleTy:
+		for i, elemType := range t.TupleElems {
+			for _, elem := range shrinkValue(*elemType, v.Field(i)) {
+				c := reflect.New(v.Type()).Elem()
+				c.Set(v)
+				c.Field(i).Set(elem)
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	return
+}
+
+// shrinkInt returns 0, x/2 and x-1 moving towards zero, without duplicates.
+func shrinkInt(x *big.Int) (candidates []*big.Int) {
+	if x.Sign() == 0 {
+		return
+	}
+	add := func(y *big.Int) {
+		for _, c := range candidates {
+			if c.Cmp(y) == 0 {
+				return
+			}
+		}
+		if y.Cmp(x) != 0 {
+			candidates = append(candidates, y)
+		}
+	}
+	add(big.NewInt(0))
+	add(new(big.Int).Quo(x, big.NewInt(2)))
+	add(new(big.Int).Sub(x, big.NewInt(int64(x.Sign()))))
+	return
+}
+
+// formatCall prints a call of method with args, in solidity syntax.
+func formatCall(method abi.Method, args []reflect.Value) string {
+	items := make([]string, len(args))
+	for i := range args {
+		items[i] = formatValue(args[i])
+	}
+	return fmt.Sprintf("%s(%s)", method.Name, strings.Join(items, ", "))
+}
+
+func formatValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case string:
+		return fmt.Sprintf("%q", value)
+	case []byte:
+		return hexutil.Encode(value)
+	case common.Address:
+		return value.Hex()
+	case *big.Int:
+		return value.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("0x%x", v.Interface())
+		}
+		fallthrough
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Struct:
+		items := make([]string, v.NumField())
+		for i := range items {
+			items[i] = formatValue(v.Field(i))
+		}
+		return "(" + strings.Join(items, ", ") + ")"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
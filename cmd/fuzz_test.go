@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"gotest.tools/assert"
+)
+
+func TestShrinkInt(t *testing.T) {
+	assert.Equal(t, len(shrinkInt(big.NewInt(0))), 0)
+
+	var got []string
+	for _, x := range shrinkInt(big.NewInt(10)) {
+		got = append(got, x.String())
+	}
+	assert.DeepEqual(t, got, []string{"0", "5", "9"})
+
+	got = nil
+	for _, x := range shrinkInt(big.NewInt(-3)) {
+		got = append(got, x.String())
+	}
+	assert.DeepEqual(t, got, []string{"0", "-1", "-2"})
+
+	got = nil
+	for _, x := range shrinkInt(big.NewInt(1)) {
+		got = append(got, x.String())
+	}
+	assert.DeepEqual(t, got, []string{"0"})
+}
+
+func TestShrinkValue(t *testing.T) {
+	candidates := shrinkValue(abi.Type{T: abi.BoolTy}, reflect.ValueOf(true))
+	assert.Equal(t, len(candidates), 1)
+	assert.Equal(t, candidates[0].Bool(), false)
+	assert.Equal(t, len(shrinkValue(abi.Type{T: abi.BoolTy}, reflect.ValueOf(false))), 0)
+
+	candidates = shrinkValue(abi.Type{T: abi.BytesTy}, reflect.ValueOf([]byte{1, 2, 3, 4}))
+	assert.DeepEqual(t, candidates[0].Bytes(), []byte{})
+	assert.DeepEqual(t, candidates[1].Bytes(), []byte{1, 2})
+	assert.DeepEqual(t, candidates[2].Bytes(), []byte{1, 2, 3})
+}
@@ -0,0 +1,366 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+)
+
+var clientInvariantCmd = cli.Command{
+	Name:      "invariant",
+	Usage:     "call random sequences of methods of deployed contracts from random senders, checking their invariant* functions after each call",
+	ArgsUsage: "<contract_path:address>...",
+	Action:    clientInvariant,
+	Flags: []cli.Flag{
+		flag.SolcFlag,
+		flag.SendersFlag,
+		flag.RunsFlag,
+		flag.DepthFlag,
+		flag.SeedFlag,
+		flag.FailOnRevertFlag,
+		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+// invariants are the functions named invariant*, taking no input and returning a bool.
+const invariantPrefix = "invariant"
+
+// invariantTarget is a deployed contract the sequences call into.
+type invariantTarget struct {
+	name    string
+	address common.Address
+	// the state changing methods
+	methods    []abi.Method
+	invariants []abi.Method
+}
+
+// invariantCall is a step of a sequence.
+type invariantCall struct {
+	sender common.Address
+	target *invariantTarget
+	method abi.Method
+	args   []reflect.Value
+}
+
+func (call invariantCall) String() string {
+	return fmt.Sprintf("%s %s.%s", call.sender.Hex(), call.target.name, formatCall(call.method, call.args))
+}
+
+type invariantTester struct {
+	*fuzzer
+	targets []*invariantTarget
+	senders []common.Address
+	depth   int
+}
+
+func clientInvariant(ctx *cli.Context) (err error) {
+	if len(ctx.Args()) == 0 {
+		err = fmt.Errorf("at least one contract_path:address is required")
+		return
+	}
+
+	seed := fuzzSeed(ctx)
+	it := &invariantTester{
+		fuzzer: &fuzzer{
+			ctx:          ctx,
+			rand:         rand.New(rand.NewSource(seed)),
+			failOnRevert: ctx.Bool(flag.FailOnRevertFlag.Name),
+		},
+		depth: ctx.Int(flag.DepthFlag.Name),
+	}
+	if it.depth <= 0 {
+		err = fmt.Errorf("invalid depth:%d", it.depth)
+		return
+	}
+
+	var invariants int
+	for _, arg := range ctx.Args() {
+		var target *invariantTarget
+		target, err = loadInvariantTarget(ctx.String(flag.SolcFlag.Name), arg)
+		if err != nil {
+			return
+		}
+		it.targets = append(it.targets, target)
+		it.addresses = append(it.addresses, target.address)
+		invariants += len(target.invariants)
+	}
+	if invariants == 0 {
+		err = fmt.Errorf("no %s* function found", invariantPrefix)
+		return
+	}
+
+	it.senders, err = invariantSenders(ctx)
+	if err != nil {
+		return
+	}
+	it.sender = it.senders[0]
+	it.addresses = append(append([]common.Address{{}}, it.senders...), it.addresses...)
+
+	err = it.takeSnapshot()
+	if err != nil {
+		return
+	}
+	// the lab state is left as it was
+	defer func() {
+		if revertErr := it.revert(); err == nil {
+			err = revertErr
+		}
+	}()
+
+	fmt.Printf("checking %d invariants with %d sequences of %d calls from %d senders, seed %d\n", invariants, ctx.Int(flag.RunsFlag.Name), it.depth, len(it.senders), seed)
+
+	// the invariants must hold before any call, or every sequence would break them
+	_, reason, err := it.run(nil)
+	if err != nil {
+		return
+	}
+	if reason != "" {
+		err = fmt.Errorf("%s before any call", reason)
+		return
+	}
+
+	for i := 0; i < ctx.Int(flag.RunsFlag.Name); i++ {
+		calls := it.generateSequence()
+
+		var failedAt int
+		failedAt, reason, err = it.run(calls)
+		if err != nil {
+			return
+		}
+		if failedAt < 0 {
+			continue
+		}
+
+		calls, reason, err = it.shrink(calls[:failedAt+1], reason)
+		if err != nil {
+			return
+		}
+		fmt.Printf("[FAIL. Reason: %s] after %d calls:\n", reason, len(calls))
+		for _, call := range calls {
+			fmt.Println("  " + call.String())
+		}
+		err = fmt.Errorf("invariant broken, seed %d", seed)
+		return
+	}
+
+	fmt.Printf("[PASS] %d sequences\n", ctx.Int(flag.RunsFlag.Name))
+	return
+}
+
+// loadInvariantTarget compiles the contract of a contract_path:address argument.
+func loadInvariantTarget(solc, arg string) (target *invariantTarget, err error) {
+	sep := strings.LastIndex(arg, ":")
+	if sep < 0 || !common.IsHexAddress(arg[sep+1:]) {
+		err = fmt.Errorf("invalid target %q, should be contract_path:address", arg)
+		return
+	}
+	contract, err := compileContractFile(solc, arg[:sep])
+	if err != nil {
+		return
+	}
+
+	target = &invariantTarget{name: contract.Name, address: common.HexToAddress(arg[sep+1:])}
+	for _, method := range contract.ABI.Methods {
+		switch {
+		case strings.HasPrefix(method.Name, invariantPrefix):
+			err = checkPropertyMethod(method)
+			if err != nil {
+				return
+			}
+			target.invariants = append(target.invariants, method)
+		case method.IsConstant():
+			// calling a view function changes nothing
+		case !fuzzable(method.Inputs):
+			fmt.Printf("skipping %s.%s, unsupported input type\n", target.name, method.Sig)
+		default:
+			target.methods = append(target.methods, method)
+		}
+	}
+	sort.Slice(target.methods, func(i, j int) bool { return target.methods[i].Sig < target.methods[j].Sig })
+	sort.Slice(target.invariants, func(i, j int) bool { return target.invariants[i].Name < target.invariants[j].Name })
+	return
+}
+
+// invariantSenders returns the senders flag, or the genesis accounts, sorted.
+func invariantSenders(ctx *cli.Context) (senders []common.Address, err error) {
+	for _, sender := range splitList(ctx.String(flag.SendersFlag.Name)) {
+		if !common.IsHexAddress(sender) {
+			err = fmt.Errorf("invalid sender:%s", sender)
+			return
+		}
+		senders = append(senders, common.HexToAddress(sender))
+	}
+	if len(senders) == 0 {
+		senders, err = genesisAccounts(ctx)
+		if err != nil {
+			return
+		}
+	}
+	if len(senders) == 0 {
+		err = fmt.Errorf("no sender, specify %s or fund some accounts in the genesis", flag.SendersFlag.Name)
+	}
+	return
+}
+
+func (it *invariantTester) generateSequence() (calls []invariantCall) {
+	var targets []*invariantTarget
+	for _, target := range it.targets {
+		if len(target.methods) > 0 {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	for i := 0; i < it.depth; i++ {
+		target := targets[it.rand.Intn(len(targets))]
+		call := invariantCall{
+			sender: it.senders[it.rand.Intn(len(it.senders))],
+			target: target,
+			method: target.methods[it.rand.Intn(len(target.methods))],
+		}
+		for _, input := range call.method.Inputs {
+			call.args = append(call.args, it.generate(input.Type))
+		}
+		calls = append(calls, call)
+	}
+	return
+}
+
+// run replays calls on the snapshot, checking the invariants after each of them. It returns the
+// index of the call after which an invariant was broken and why, -1 if none was.
+func (it *invariantTester) run(calls []invariantCall) (failedAt int, reason string, err error) {
+	err = it.revert()
+	if err != nil {
+		return
+	}
+
+	failedAt = -1
+	reason, err = it.checkInvariants()
+	if err != nil || reason != "" {
+		return
+	}
+
+	for i, call := range calls {
+		values := make([]interface{}, len(call.args))
+		for j := range call.args {
+			values[j] = call.args[j].Interface()
+		}
+		output, callErr := it.callFrom(call.sender, call.target.address, call.method, values)
+		if callErr != nil {
+			err = callErr
+			return
+		}
+		if output.ErrMsg != "" {
+			// a reverted call changes nothing, unless reverts are failures
+			if revertReason := it.unexpectedRevert(output); revertReason != "" {
+				return i, fmt.Sprintf("%s.%s failed: %s", call.target.name, call.method.Name, revertReason), nil
+			}
+			continue
+		}
+
+		reason, err = it.checkInvariants()
+		if err != nil {
+			return
+		}
+		if reason != "" {
+			failedAt = i
+			return
+		}
+	}
+	return
+}
+
+func (it *invariantTester) checkInvariants() (reason string, err error) {
+	for _, target := range it.targets {
+		for _, invariant := range target.invariants {
+			reason, err = it.checkProperty(target.address, invariant)
+			if err != nil {
+				return
+			}
+			if reason != "" {
+				reason = target.name + "." + reason
+				return
+			}
+		}
+	}
+	return
+}
+
+// shrink drops the calls which are not needed to break an invariant, then simplifies the
+// inputs of the remaining ones, as long as the sequence keeps failing.
+func (it *invariantTester) shrink(calls []invariantCall, reason string) (_ []invariantCall, _ string, err error) {
+	attempts := 0
+	try := func(candidate []invariantCall) (bool, error) {
+		attempts++
+		failedAt, candidateReason, err := it.run(candidate)
+		if err != nil || failedAt < 0 {
+			return false, err
+		}
+		calls, reason = candidate[:failedAt+1], candidateReason
+		return true, nil
+	}
+
+	for shrunk := true; shrunk && attempts < maxShrinks; {
+		shrunk = false
+		for i := 0; i < len(calls) && !shrunk && attempts < maxShrinks; i++ {
+			candidate := append(append([]invariantCall{}, calls[:i]...), calls[i+1:]...)
+			shrunk, err = try(candidate)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	for shrunk := true; shrunk && attempts < maxShrinks; {
+		shrunk = false
+		for i := 0; i < len(calls) && !shrunk; i++ {
+			for j := 0; j < len(calls[i].args) && !shrunk; j++ {
+				for _, arg := range shrinkValue(calls[i].method.Inputs[j].Type, calls[i].args[j]) {
+					if attempts >= maxShrinks {
+						break
+					}
+					candidate := append([]invariantCall{}, calls...)
+					candidate[i].args = append([]reflect.Value{}, calls[i].args...)
+					candidate[i].args[j] = arg
+					shrunk, err = try(candidate)
+					if err != nil {
+						return
+					}
+					if shrunk {
+						break
+					}
+				}
+			}
+		}
+	}
+	return calls, reason, nil
+}
+
+// genesisAccounts returns the accounts of the genesis alloc, sorted.
+func genesisAccounts(ctx *cli.Context) (accounts []common.Address, err error) {
+	conf, err := loadConfig(ctx)
+	if err != nil {
+		return
+	}
+	if conf.Genesis != nil {
+		for addr := range conf.Genesis.Alloc {
+			accounts = append(accounts, addr)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return bytes.Compare(accounts[i][:], accounts[j][:]) < 0 })
+	return
+}
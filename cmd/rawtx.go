@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+)
+
+var clientSendRawCmd = cli.Command{
+	Name:      "send-raw",
+	Usage:     "replay signed txs, legacy or typed, with the nonce, fee and signature checks of a node",
+	ArgsUsage: "[0x-prefixed signed tx...], one per line from stdin if none",
+	Action:    clientSendRaw,
+	Flags: []cli.Flag{
+		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+// clientSendRaw sends the txs in order, and stops at the first one rejected, since the
+// following ones usually depend on it.
+func clientSendRaw(ctx *cli.Context) (err error) {
+	txs := []string(ctx.Args())
+	if len(txs) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(nil, 1<<24)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				txs = append(txs, line)
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return
+		}
+	}
+
+	c, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	for i, tx := range txs {
+		var txBytes []byte
+		txBytes, err = hexutil.Decode(tx)
+		if err != nil {
+			err = fmt.Errorf("tx %d: %v", i, err)
+			return
+		}
+		output, sendErr := c.SendRawTransaction(context.Background(), txBytes)
+		if sendErr != nil {
+			return sendErr
+		}
+
+		outputBytes, _ := json.Marshal(output)
+		fmt.Println("output", string(outputBytes))
+		if !output.Executed {
+			err = fmt.Errorf("tx %d %s rejected: %s", i, output.Hash.Hex(), output.ErrMsg)
+			return
+		}
+	}
+	return
+}
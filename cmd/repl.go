@@ -0,0 +1,487 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/peterh/liner"
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/server"
+)
+
+var clientReplCmd = cli.Command{
+	Name:   "repl",
+	Usage:  "an interactive session to deploy, call, inspect balances and take snapshots, compiling each contract once",
+	Action: clientRepl,
+	Flags: []cli.Flag{
+		flag.SolcFlag,
+		flag.GasFlag,
+		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+const replHelp = `deploy <path>[(args...)]    compile and deploy the contract named after the file, e.g. deploy Token.sol(1000)
+at <path> <address>         use the contract of path already deployed at address
+<name>.<method>(args...)    call a method of a contract, e.g. Token.transfer(0x.., 100), [..] for arrays and tuples
+balance <name|address>      print the balance and nonce of an account
+sender [address]            print or change the sender
+snapshot                    save the lab state
+revert <id>                 restore a saved lab state
+contracts                   list the contracts
+exit`
+
+// replSource is a compiled contract file, compiled again only when it changes.
+type replSource struct {
+	modTime  time.Time
+	contract *compiledContract
+}
+
+type replContract struct {
+	address  common.Address
+	contract *compiledContract
+}
+
+type repl struct {
+	ctx    *cli.Context
+	solc   string
+	gas    uint64
+	sender common.Address
+	// by path
+	sources map[string]*replSource
+	// by contract name, the last deploy of a name wins
+	contracts map[string]*replContract
+	// events of all the compiled contracts, by id
+	events map[common.Hash]abi.Event
+}
+
+func clientRepl(ctx *cli.Context) (err error) {
+	r := &repl{
+		ctx:       ctx,
+		solc:      ctx.String(flag.SolcFlag.Name),
+		gas:       ctx.Uint64(flag.GasFlag.Name),
+		sources:   make(map[string]*replSource),
+		contracts: make(map[string]*replContract),
+		events:    make(map[common.Hash]abi.Event),
+	}
+	accounts, err := genesisAccounts(ctx)
+	if err != nil {
+		return
+	}
+	if len(accounts) > 0 {
+		r.sender = accounts[0]
+	}
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetCompleter(r.complete)
+
+	fmt.Printf("sender %s, type help for the commands\n", r.sender.Hex())
+	for {
+		input, promptErr := line.Prompt("> ")
+		switch {
+		case promptErr == liner.ErrPromptAborted:
+			continue
+		case promptErr == io.EOF:
+			fmt.Println()
+			return
+		case promptErr != nil:
+			err = promptErr
+			return
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+		if input == "exit" || input == "quit" {
+			return
+		}
+		if execErr := r.exec(input); execErr != nil {
+			fmt.Println("error:", execErr)
+		}
+	}
+}
+
+func (r *repl) exec(line string) error {
+	fields := strings.Fields(line)
+	rest := strings.TrimSpace(line[len(fields[0]):])
+	switch fields[0] {
+	case "help":
+		fmt.Println(replHelp)
+		return nil
+	case "deploy":
+		return r.deploy(rest)
+	case "at":
+		if len(fields) != 3 || !common.IsHexAddress(fields[2]) {
+			return fmt.Errorf("usage: at <path> <address>")
+		}
+		contract, err := r.compile(fields[1])
+		if err != nil {
+			return err
+		}
+		r.contracts[contract.Name] = &replContract{address: common.HexToAddress(fields[2]), contract: contract}
+		fmt.Printf("%s at %s\n", contract.Name, fields[2])
+		return nil
+	case "balance":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: balance <name|address>")
+		}
+		return r.balance(fields[1])
+	case "sender":
+		if len(fields) == 2 {
+			if !common.IsHexAddress(fields[1]) {
+				return fmt.Errorf("invalid sender:%s", fields[1])
+			}
+			r.sender = common.HexToAddress(fields[1])
+		}
+		fmt.Println("sender", r.sender.Hex())
+		return nil
+	case "snapshot":
+		var output lab.SnapshotOutput
+		if err := postServer(r.ctx, server.SnapshotEndpoint, struct{}{}, &output); err != nil {
+			return err
+		}
+		fmt.Println("snapshot", output.ID)
+		return nil
+	case "revert":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: revert <id>")
+		}
+		id, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid snapshot id:%s", fields[1])
+		}
+		var output lab.RevertOutput
+		if err = postServer(r.ctx, server.RevertEndpoint, lab.RevertInput{ID: id}, &output); err != nil {
+			return err
+		}
+		if output.ErrMsg != "" {
+			return fmt.Errorf("revert err:%s", output.ErrMsg)
+		}
+		fmt.Println("reverted to", id)
+		return nil
+	case "contracts":
+		for _, name := range r.contractNames() {
+			fmt.Printf("%s %s\n", name, r.contracts[name].address.Hex())
+		}
+		return nil
+	default:
+		return r.call(line)
+	}
+}
+
+func (r *repl) contractNames() (names []string) {
+	for name := range r.contracts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// compile compiles path, unless it was already compiled and did not change since.
+func (r *repl) compile(path string) (contract *compiledContract, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if source := r.sources[path]; source != nil && source.modTime.Equal(info.ModTime()) {
+		contract = source.contract
+		return
+	}
+
+	contract, err = compileContractFile(r.solc, path)
+	if err != nil {
+		return
+	}
+	r.sources[path] = &replSource{modTime: info.ModTime(), contract: contract}
+	for _, event := range contract.ABI.Events {
+		r.events[event.ID] = event
+	}
+	return
+}
+
+func (r *repl) deploy(invocation string) (err error) {
+	path, args, err := parseInvocation(invocation)
+	if err != nil {
+		return
+	}
+	contract, err := r.compile(path)
+	if err != nil {
+		return
+	}
+	packed, err := packArgs(contract.ABI.Constructor.Inputs, args)
+	if err != nil {
+		return
+	}
+
+	var output lab.DeployOutput
+	err = postServer(r.ctx, server.DeployEndpoint, lab.DeployInput{
+		Sender:       r.sender,
+		CodeAndInput: append(common.FromHex(contract.Contract.Code), packed...),
+		Gas:          r.gas,
+		Artifact:     contract.artifact(),
+	}, &output)
+	if err != nil {
+		return
+	}
+	printConsole(output.Console)
+	r.printLogs(output.Logs)
+	if output.ErrMsg != "" {
+		return fmt.Errorf("deploy failed: %s", output.ErrMsg)
+	}
+
+	r.contracts[contract.Name] = &replContract{address: output.Addr, contract: contract}
+	fmt.Printf("%s deployed at %s (gas: %d)\n", contract.Name, output.Addr.Hex(), output.GasUsed)
+	return
+}
+
+func (r *repl) call(invocation string) (err error) {
+	target, args, err := parseInvocation(invocation)
+	if err != nil {
+		return
+	}
+	dot := strings.LastIndex(target, ".")
+	if dot < 0 || !strings.Contains(invocation, "(") {
+		return fmt.Errorf("unknown command %q, type help for the commands", invocation)
+	}
+	c := r.contracts[target[:dot]]
+	if c == nil {
+		return fmt.Errorf("no contract named %s, deploy it or use at", target[:dot])
+	}
+	method, ok := c.contract.ABI.Methods[target[dot+1:]]
+	if !ok {
+		return fmt.Errorf("method %s not found in %s", target[dot+1:], c.contract.Name)
+	}
+	packed, err := packArgs(method.Inputs, args)
+	if err != nil {
+		return
+	}
+
+	var output lab.CallOutput
+	err = postServer(r.ctx, server.CallEndpoint, lab.CallInput{
+		Sender:   r.sender,
+		Receiver: c.address,
+		Input:    append(append([]byte{}, method.ID...), packed...),
+		Gas:      r.gas,
+	}, &output)
+	if err != nil {
+		return
+	}
+	printConsole(output.Console)
+	r.printLogs(output.Logs)
+	if output.ErrMsg != "" {
+		fmt.Printf("reverted: %s (gas: %d)\n", output.ErrMsg, output.GasUsed)
+		return
+	}
+
+	results, err := method.Outputs.Unpack(output.Result)
+	if err != nil {
+		return fmt.Errorf("abi.Unpack err:%v", err)
+	}
+	for i, result := range results {
+		name := method.Outputs[i].Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		fmt.Printf("%s: %s\n", name, valueString(result))
+	}
+	fmt.Printf("(gas: %d)\n", output.GasUsed)
+	return
+}
+
+// printLogs prints the logs decoded with the events of the compiled contracts, raw otherwise.
+func (r *repl) printLogs(logs []lab.Log) {
+	for _, log := range logs {
+		if len(log.Topics) > 0 {
+			if event, ok := r.events[log.Topics[0]]; ok {
+				if args, err := decodeEvent(event, log); err == nil {
+					fmt.Printf("  event %s(%s)\n", event.Name, strings.Join(args, ", "))
+					continue
+				}
+			}
+		}
+		fmt.Printf("  log %s topics:%v data:%s\n", log.Address.Hex(), log.Topics, log.Data)
+	}
+}
+
+func (r *repl) balance(account string) (err error) {
+	var addr common.Address
+	if c := r.contracts[account]; c != nil {
+		addr = c.address
+	} else if common.IsHexAddress(account) {
+		addr = common.HexToAddress(account)
+	} else {
+		return fmt.Errorf("%s is neither a contract name nor an address", account)
+	}
+
+	var output lab.GetStateOutput
+	err = postServer(r.ctx, server.GetStateEndpoint, lab.GetStateInput{Address: addr}, &output)
+	if err != nil {
+		return
+	}
+	state := output.State
+	if state.Balance == nil || state.Nonce == nil {
+		return fmt.Errorf("invalid state of %s", addr.Hex())
+	}
+	fmt.Printf("%s balance: %s nonce: %d code: %d bytes\n", addr.Hex(), state.Balance.ToInt(), *state.Nonce, len(state.Code))
+	return
+}
+
+// complete completes the commands, the contract names and methods, and the paths of deploy and at.
+func (r *repl) complete(line string) (completions []string) {
+	for _, cmd := range []string{"deploy ", "at "} {
+		if !strings.HasPrefix(line, cmd) {
+			continue
+		}
+		matches, _ := filepath.Glob(strings.TrimLeft(line[len(cmd):], " ") + "*")
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			switch {
+			case err != nil:
+			case info.IsDir():
+				completions = append(completions, cmd+match+string(filepath.Separator))
+			case strings.HasSuffix(match, ".sol"):
+				completions = append(completions, cmd+match)
+			}
+		}
+		return
+	}
+
+	candidates := []string{"deploy ", "at ", "balance ", "sender ", "snapshot", "revert ", "contracts", "help", "exit"}
+	for _, name := range r.contractNames() {
+		candidates = append(candidates, "balance "+name)
+		var methods []string
+		for method := range r.contracts[name].contract.ABI.Methods {
+			methods = append(methods, name+"."+method+"(")
+		}
+		sort.Strings(methods)
+		candidates = append(candidates, methods...)
+	}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, line) {
+			completions = append(completions, candidate)
+		}
+	}
+	return
+}
+
+// parseInvocation splits `target(args...)` into target and the parsed args, the args being
+// optional.
+func parseInvocation(s string) (target string, args []interface{}, err error) {
+	open := strings.Index(s, "(")
+	if open < 0 {
+		target = strings.TrimSpace(s)
+		return
+	}
+	if !strings.HasSuffix(s, ")") {
+		err = fmt.Errorf("missing ) in %q", s)
+		return
+	}
+	target = strings.TrimSpace(s[:open])
+	args, err = parseArgList(s[open+1 : len(s)-1])
+	return
+}
+
+// parseArgList parses comma separated values, [..] being a list, "..." a quoted string and
+// everything else a bare string, as packArgs takes them.
+func parseArgList(s string) ([]interface{}, error) {
+	p := &argParser{s: s}
+	return p.list(0)
+}
+
+type argParser struct {
+	s   string
+	pos int
+}
+
+// peek returns the next non space byte, 0 at the end.
+func (p *argParser) peek() byte {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// list parses values up to end, which is 0 for the end of the input.
+func (p *argParser) list(end byte) (items []interface{}, err error) {
+	if p.peek() == end {
+		p.pos++
+		return
+	}
+	for {
+		var item interface{}
+		item, err = p.value()
+		if err != nil {
+			return
+		}
+		items = append(items, item)
+
+		switch c := p.peek(); c {
+		case ',':
+			p.pos++
+		case end:
+			p.pos++
+			return
+		case 0:
+			err = fmt.Errorf("missing %c", end)
+			return
+		default:
+			err = fmt.Errorf("unexpected %c at %d", c, p.pos)
+			return
+		}
+	}
+}
+
+func (p *argParser) value() (interface{}, error) {
+	switch p.peek() {
+	case '[':
+		p.pos++
+		items, err := p.list(']')
+		if items == nil && err == nil {
+			items = []interface{}{}
+		}
+		return items, err
+	case '"':
+		end := p.pos + 1
+		for ; end < len(p.s) && p.s[end] != '"'; end++ {
+			if p.s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(p.s) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		str, err := strconv.Unquote(p.s[p.pos : end+1])
+		p.pos = end + 1
+		return str, err
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(",]", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	value := strings.TrimSpace(p.s[start:p.pos])
+	if value == "" {
+		return nil, fmt.Errorf("missing value at %d", start)
+	}
+	return value, nil
+}
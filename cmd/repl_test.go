@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParseInvocation(t *testing.T) {
+	target, args, err := parseInvocation(`Token.transfer(0x05fF834dD5a7EDB437B061CB00108200bf4873D6, 100)`)
+	assert.NilError(t, err)
+	assert.Equal(t, target, "Token.transfer")
+	assert.DeepEqual(t, args, []interface{}{"0x05fF834dD5a7EDB437B061CB00108200bf4873D6", "100"})
+
+	target, args, err = parseInvocation("Token.sol")
+	assert.NilError(t, err)
+	assert.Equal(t, target, "Token.sol")
+	assert.Equal(t, len(args), 0)
+
+	_, args, err = parseInvocation(`f([1, [2, 3]], "a, \"b\"", [])`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, args, []interface{}{
+		[]interface{}{"1", []interface{}{"2", "3"}},
+		`a, "b"`,
+		[]interface{}{},
+	})
+
+	for _, invalid := range []string{"f(1", "f(1,)", "f([1)", `f("a)`, "f(1 2])"} {
+		_, _, err = parseInvocation(invalid)
+		assert.Assert(t, err != nil, invalid)
+	}
+}
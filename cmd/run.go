@@ -0,0 +1,729 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/server"
+	"gopkg.in/yaml.v2"
+)
+
+var clientRunCmd = cli.Command{
+	Name:      "run",
+	Usage:     "run the steps of a yaml or json scenario file against the lab, stopping at the first failure",
+	ArgsUsage: "<scenario file>",
+	Action:    clientRun,
+	Flags: []cli.Flag{
+		flag.SolcFlag,
+		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+// scenario is a lab session written down, see the README for an example.
+type scenario struct {
+	// solc path, the solc flag by default
+	Solc string
+	// sender of the steps which don't specify one
+	Sender string
+	// values referenced as ${name} in the steps
+	Vars  map[string]string
+	Steps []scenarioStep
+}
+
+// scenarioStep has exactly one of Deploy, Call, Assert, SetState, Snapshot and Revert set.
+// The results of the deploys and calls are referenced by the later steps as ${name.address},
+// ${name.result.<index or output name>} and ${name.gasUsed}.
+type scenarioStep struct {
+	// the contract name for deploys and the method for calls by default
+	Name string
+	// contract path to deploy, relative to the scenario file
+	Deploy string
+	// name of a deploy step, or address to call
+	Call string
+	// contract path of Call when it is an address which was not deployed by the scenario
+	Contract string
+	Method   string
+	// constructor args of deploys, method args of calls
+	Args   []interface{}
+	Sender string
+	Value  string
+	Gas    uint64
+	// a deploy or call without Expect must succeed
+	Expect   *scenarioExpect
+	Assert   *scenarioAssert
+	SetState *scenarioSetState `yaml:"setState"`
+	// saves the lab state under a name
+	Snapshot string
+	// restores the lab state saved by a snapshot step
+	Revert string
+}
+
+type scenarioExpect struct {
+	Revert bool
+	// a substring of the error, implies Revert
+	Reason string
+	// the values returned by the call, in order
+	Result []interface{}
+	// events which should be emitted in this order, among others
+	Events []scenarioEvent
+}
+
+type scenarioEvent struct {
+	Name string
+	// the emitter, any by default
+	Address string
+	// all the args in order, indexed or not, unchecked when empty
+	Args []interface{}
+}
+
+// scenarioAssert compares two values, as numbers for the order
+type scenarioAssert struct {
+	Eq []string
+	Ne []string
+	Lt []string
+	Le []string
+	Gt []string
+	Ge []string
+}
+
+// scenarioSetState overwrites the fields of an account which are set
+type scenarioSetState struct {
+	Address string
+	Balance string
+	Nonce   *uint64
+	Code    string
+	Storage map[string]string
+}
+
+var scenarioVarRegexp = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+type scenarioRunner struct {
+	ctx    *cli.Context
+	dir    string
+	solc   string
+	sender string
+	vars   map[string]string
+	// compiled contracts by path
+	contracts map[string]*compiledContract
+	// contracts deployed by the scenario, by step name and by address
+	deployed  map[string]*compiledContract
+	addresses map[string]common.Address
+	byAddress map[common.Address]*compiledContract
+	// events of all the compiled contracts, by id
+	events    map[common.Hash]abi.Event
+	snapshots map[string]uint64
+}
+
+func clientRun(ctx *cli.Context) (err error) {
+	if len(ctx.Args()) != 1 {
+		err = fmt.Errorf("exactly one scenario file expected")
+		return
+	}
+	path := ctx.Args()[0]
+	s, err := loadScenario(path)
+	if err != nil {
+		return
+	}
+
+	r := &scenarioRunner{
+		ctx:       ctx,
+		dir:       filepath.Dir(path),
+		solc:      s.Solc,
+		sender:    s.Sender,
+		vars:      make(map[string]string),
+		contracts: make(map[string]*compiledContract),
+		deployed:  make(map[string]*compiledContract),
+		addresses: make(map[string]common.Address),
+		byAddress: make(map[common.Address]*compiledContract),
+		events:    make(map[common.Hash]abi.Event),
+		snapshots: make(map[string]uint64),
+	}
+	if r.solc == "" {
+		r.solc = ctx.String(flag.SolcFlag.Name)
+	}
+	for name, value := range s.Vars {
+		r.vars[name] = value
+	}
+	r.vars["sender"] = s.Sender
+
+	for i, step := range s.Steps {
+		err = r.runStep(&step)
+		if err != nil {
+			fmt.Printf("[FAIL. Reason: %v] step %d %s\n", err, i+1, step.Name)
+			err = fmt.Errorf("scenario failed at step %d", i+1)
+			return
+		}
+	}
+	fmt.Printf("\nScenario result: ok. %d steps passed\n", len(s.Steps))
+	return
+}
+
+// loadScenario reads a scenario file, as json when it has the .json extension, yaml otherwise.
+func loadScenario(path string) (s scenario, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		// keep the numbers as written, large ones included
+		decoder.UseNumber()
+		err = decoder.Decode(&s)
+	} else {
+		err = yaml.UnmarshalStrict(data, &s)
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid scenario %s: %v", path, err)
+	}
+	return
+}
+
+func (r *scenarioRunner) runStep(step *scenarioStep) error {
+	var kinds int
+	for _, set := range []bool{step.Deploy != "", step.Call != "", step.Assert != nil, step.SetState != nil, step.Snapshot != "", step.Revert != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("a step should have exactly one of deploy, call, assert, setState, snapshot and revert")
+	}
+
+	switch {
+	case step.Deploy != "":
+		return r.deploy(step)
+	case step.Call != "":
+		return r.call(step)
+	case step.Assert != nil:
+		return r.assert(step.Assert)
+	case step.SetState != nil:
+		return r.setState(step.SetState)
+	case step.Snapshot != "":
+		var output lab.SnapshotOutput
+		if err := postServer(r.ctx, server.SnapshotEndpoint, struct{}{}, &output); err != nil {
+			return err
+		}
+		r.snapshots[step.Snapshot] = output.ID
+		fmt.Printf("[OK] snapshot %s\n", step.Snapshot)
+		return nil
+	default:
+		id, ok := r.snapshots[step.Revert]
+		if !ok {
+			return fmt.Errorf("snapshot %s not found", step.Revert)
+		}
+		var output lab.RevertOutput
+		if err := postServer(r.ctx, server.RevertEndpoint, lab.RevertInput{ID: id}, &output); err != nil {
+			return err
+		}
+		if output.ErrMsg != "" {
+			return fmt.Errorf("revert err:%s", output.ErrMsg)
+		}
+		fmt.Printf("[OK] revert %s\n", step.Revert)
+		return nil
+	}
+}
+
+// expand replaces the ${name} references of s by their values.
+func (r *scenarioRunner) expand(s string) (expanded string, err error) {
+	expanded = scenarioVarRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		name := scenarioVarRegexp.FindStringSubmatch(ref)[1]
+		value, ok := r.vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("undefined %s", ref)
+		}
+		return value
+	})
+	return
+}
+
+// expandArgs expands the strings of args, in lists as well.
+func (r *scenarioRunner) expandArgs(args []interface{}) (expanded []interface{}, err error) {
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			var s string
+			s, err = r.expand(v)
+			if err != nil {
+				return
+			}
+			expanded = append(expanded, s)
+		case []interface{}:
+			var items []interface{}
+			items, err = r.expandArgs(v)
+			if err != nil {
+				return
+			}
+			expanded = append(expanded, items)
+		default:
+			expanded = append(expanded, arg)
+		}
+	}
+	return
+}
+
+func (r *scenarioRunner) compile(path string) (contract *compiledContract, err error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.dir, path)
+	}
+	if contract = r.contracts[path]; contract != nil {
+		return
+	}
+	contract, err = compileContractFile(r.solc, path)
+	if err != nil {
+		return
+	}
+	r.contracts[path] = contract
+	for _, event := range contract.ABI.Events {
+		r.events[event.ID] = event
+	}
+	return
+}
+
+// txSender returns the sender of step, the default sender of the scenario if none.
+func (r *scenarioRunner) txSender(step *scenarioStep) (sender common.Address, err error) {
+	s := step.Sender
+	if s == "" {
+		s = r.sender
+	}
+	s, err = r.expand(s)
+	if err != nil {
+		return
+	}
+	if !common.IsHexAddress(s) {
+		err = fmt.Errorf("invalid sender:%q", s)
+		return
+	}
+	sender = common.HexToAddress(s)
+	return
+}
+
+func (r *scenarioRunner) txValue(step *scenarioStep) (value *big.Int, err error) {
+	if step.Value == "" {
+		return
+	}
+	s, err := r.expand(step.Value)
+	if err != nil {
+		return
+	}
+	value, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		err = fmt.Errorf("invalid value:%s", s)
+	}
+	return
+}
+
+func (r *scenarioRunner) deploy(step *scenarioStep) (err error) {
+	contract, err := r.compile(step.Deploy)
+	if err != nil {
+		return
+	}
+	if step.Name == "" {
+		step.Name = contract.Name
+	}
+	sender, err := r.txSender(step)
+	if err != nil {
+		return
+	}
+	value, err := r.txValue(step)
+	if err != nil {
+		return
+	}
+	args, err := r.expandArgs(step.Args)
+	if err != nil {
+		return
+	}
+	packed, err := packArgs(contract.ABI.Constructor.Inputs, args)
+	if err != nil {
+		return
+	}
+
+	var output lab.DeployOutput
+	err = postServer(r.ctx, server.DeployEndpoint, lab.DeployInput{
+		Sender:       sender,
+		CodeAndInput: append(common.FromHex(contract.Contract.Code), packed...),
+		Gas:          step.Gas,
+		Value:        value,
+		Artifact:     contract.artifact(),
+	}, &output)
+	if err != nil {
+		return
+	}
+	printConsole(output.Console)
+	err = r.check(step.Expect, output.ErrMsg, nil, output.Logs)
+	if err != nil || output.ErrMsg != "" {
+		return
+	}
+
+	r.deployed[step.Name] = contract
+	r.addresses[step.Name] = output.Addr
+	r.byAddress[output.Addr] = contract
+	r.vars[step.Name+".address"] = output.Addr.Hex()
+	r.vars[step.Name+".gasUsed"] = fmt.Sprint(output.GasUsed)
+	fmt.Printf("[OK] deploy %s at %s (gas: %d)\n", step.Name, output.Addr.Hex(), output.GasUsed)
+	return
+}
+
+// target resolves the contract called by step.
+func (r *scenarioRunner) target(step *scenarioStep) (addr common.Address, contract *compiledContract, err error) {
+	if contract = r.deployed[step.Call]; contract != nil {
+		addr = r.addresses[step.Call]
+		return
+	}
+
+	s, err := r.expand(step.Call)
+	if err != nil {
+		return
+	}
+	if !common.IsHexAddress(s) {
+		err = fmt.Errorf("%s is neither a deploy step nor an address", step.Call)
+		return
+	}
+	addr = common.HexToAddress(s)
+	if step.Contract != "" {
+		contract, err = r.compile(step.Contract)
+		return
+	}
+	if contract = r.byAddress[addr]; contract == nil {
+		err = fmt.Errorf("the contract of %s is unknown, specify its contract path", s)
+	}
+	return
+}
+
+func (r *scenarioRunner) call(step *scenarioStep) (err error) {
+	addr, contract, err := r.target(step)
+	if err != nil {
+		return
+	}
+	method, ok := contract.ABI.Methods[step.Method]
+	if !ok {
+		err = fmt.Errorf("method %s not found in %s", step.Method, contract.Name)
+		return
+	}
+	if step.Name == "" {
+		step.Name = step.Method
+	}
+	sender, err := r.txSender(step)
+	if err != nil {
+		return
+	}
+	value, err := r.txValue(step)
+	if err != nil {
+		return
+	}
+	args, err := r.expandArgs(step.Args)
+	if err != nil {
+		return
+	}
+	packed, err := packArgs(method.Inputs, args)
+	if err != nil {
+		return
+	}
+
+	var output lab.CallOutput
+	err = postServer(r.ctx, server.CallEndpoint, lab.CallInput{
+		Sender:   sender,
+		Receiver: addr,
+		Input:    append(append([]byte{}, method.ID...), packed...),
+		Gas:      step.Gas,
+		Value:    value,
+	}, &output)
+	if err != nil {
+		return
+	}
+	printConsole(output.Console)
+
+	var results []interface{}
+	if output.ErrMsg == "" {
+		results, err = method.Outputs.Unpack(output.Result)
+		if err != nil {
+			err = fmt.Errorf("abi.Unpack err:%v", err)
+			return
+		}
+	}
+	err = r.check(step.Expect, output.ErrMsg, results, output.Logs)
+	if err != nil {
+		return
+	}
+
+	for i, result := range results {
+		r.vars[fmt.Sprintf("%s.result.%d", step.Name, i)] = valueString(result)
+		if name := method.Outputs[i].Name; name != "" {
+			r.vars[fmt.Sprintf("%s.result.%s", step.Name, name)] = valueString(result)
+		}
+	}
+	r.vars[step.Name+".gasUsed"] = fmt.Sprint(output.GasUsed)
+
+	status := "OK"
+	if output.ErrMsg != "" {
+		status = "OK, reverted"
+	}
+	fmt.Printf("[%s] %s.%s(%s) (gas: %d)\n", status, contract.Name, method.Name, strings.Join(argStrings(args), ", "), output.GasUsed)
+	return
+}
+
+func printConsole(lines []string) {
+	for _, line := range lines {
+		fmt.Println("  " + line)
+	}
+}
+
+// argStrings is the text of args as written in the scenario, lists included.
+func argStrings(args []interface{}) (texts []string) {
+	for _, arg := range args {
+		if items, ok := arg.([]interface{}); ok {
+			texts = append(texts, "["+strings.Join(argStrings(items), ", ")+"]")
+			continue
+		}
+		texts = append(texts, fmt.Sprint(arg))
+	}
+	return
+}
+
+// check compares the outcome of a deploy or call with expect.
+func (r *scenarioRunner) check(expect *scenarioExpect, errMsg string, results []interface{}, logs []lab.Log) (err error) {
+	if expect == nil {
+		expect = &scenarioExpect{}
+	}
+	if errMsg != "" {
+		if !expect.Revert && expect.Reason == "" {
+			return fmt.Errorf("unexpected revert: %s", errMsg)
+		}
+		if !strings.Contains(errMsg, expect.Reason) {
+			return fmt.Errorf("expected revert reason %q, got: %s", expect.Reason, errMsg)
+		}
+		return nil
+	}
+	if expect.Revert || expect.Reason != "" {
+		return fmt.Errorf("expected to revert")
+	}
+
+	if expect.Result != nil {
+		expected, err := r.expandArgs(expect.Result)
+		if err != nil {
+			return err
+		}
+		if len(expected) != len(results) {
+			return fmt.Errorf("expected %d results, got %d", len(expected), len(results))
+		}
+		texts := argStrings(expected)
+		for i := range results {
+			if actual := valueString(results[i]); !sameValue(texts[i], actual) {
+				return fmt.Errorf("expected result %d to be %s, got %s", i, texts[i], actual)
+			}
+		}
+	}
+
+	next := 0
+	for _, event := range expect.Events {
+		found := false
+		for ; next < len(logs) && !found; next++ {
+			found, err = r.matchEvent(event, logs[next])
+			if err != nil {
+				return
+			}
+		}
+		if !found {
+			return fmt.Errorf("event %s not emitted", event.Name)
+		}
+	}
+	return nil
+}
+
+func (r *scenarioRunner) matchEvent(expected scenarioEvent, log lab.Log) (bool, error) {
+	if len(log.Topics) == 0 {
+		return false, nil
+	}
+	event, ok := r.events[log.Topics[0]]
+	if !ok || event.Name != expected.Name {
+		return false, nil
+	}
+	if expected.Address != "" {
+		addr, err := r.expand(expected.Address)
+		if err != nil {
+			return false, err
+		}
+		if !sameValue(addr, log.Address.Hex()) {
+			return false, nil
+		}
+	}
+	if len(expected.Args) == 0 {
+		return true, nil
+	}
+
+	actual, err := decodeEvent(event, log)
+	if err != nil {
+		return false, err
+	}
+	args, err := r.expandArgs(expected.Args)
+	if err != nil {
+		return false, err
+	}
+	if len(args) != len(actual) {
+		return false, nil
+	}
+	for i, text := range argStrings(args) {
+		if !sameValue(text, actual[i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// decodeEvent returns the text of the args of log, indexed or not, in order.
+// The indexed dynamic values are only available as their hash.
+func decodeEvent(event abi.Event, log lab.Log) (args []string, err error) {
+	nonIndexed, err := event.Inputs.NonIndexed().Unpack(log.Data)
+	if err != nil {
+		err = fmt.Errorf("decode %s err:%v", event.Name, err)
+		return
+	}
+	topics := log.Topics[1:]
+
+	for _, input := range event.Inputs {
+		if !input.Indexed {
+			args = append(args, valueString(nonIndexed[0]))
+			nonIndexed = nonIndexed[1:]
+			continue
+		}
+		if len(topics) == 0 {
+			err = fmt.Errorf("missing topics of %s", event.Name)
+			return
+		}
+		topic := topics[0]
+		topics = topics[1:]
+		switch input.Type.T {
+		case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+			args = append(args, topic.Hex())
+		default:
+			var values []interface{}
+			values, err = abi.Arguments{{Type: input.Type}}.Unpack(topic[:])
+			if err != nil {
+				return
+			}
+			args = append(args, valueString(values[0]))
+		}
+	}
+	return
+}
+
+func (r *scenarioRunner) assert(a *scenarioAssert) (err error) {
+	ops := []struct {
+		name     string
+		operands []string
+	}{{"eq", a.Eq}, {"ne", a.Ne}, {"lt", a.Lt}, {"le", a.Le}, {"gt", a.Gt}, {"ge", a.Ge}}
+
+	var checked int
+	for _, op := range ops {
+		if op.operands == nil {
+			continue
+		}
+		checked++
+		if len(op.operands) != 2 {
+			return fmt.Errorf("%s takes 2 operands", op.name)
+		}
+		var x, y string
+		if x, err = r.expand(op.operands[0]); err != nil {
+			return
+		}
+		if y, err = r.expand(op.operands[1]); err != nil {
+			return
+		}
+
+		var ok bool
+		switch op.name {
+		case "eq":
+			ok = sameValue(x, y)
+		case "ne":
+			ok = !sameValue(x, y)
+		default:
+			bx, okX := new(big.Int).SetString(x, 0)
+			by, okY := new(big.Int).SetString(y, 0)
+			if !okX || !okY {
+				return fmt.Errorf("%s takes numbers, got %s and %s", op.name, x, y)
+			}
+			cmp := bx.Cmp(by)
+			ok = map[string]bool{"lt": cmp < 0, "le": cmp <= 0, "gt": cmp > 0, "ge": cmp >= 0}[op.name]
+		}
+		if !ok {
+			return fmt.Errorf("assertion failed: %s %s %s", x, op.name, y)
+		}
+		fmt.Printf("[OK] assert %s %s %s\n", x, op.name, y)
+	}
+	if checked == 0 {
+		return fmt.Errorf("empty assert")
+	}
+	return nil
+}
+
+func (r *scenarioRunner) setState(set *scenarioSetState) (err error) {
+	addr, err := r.expand(set.Address)
+	if err != nil {
+		return
+	}
+	if !common.IsHexAddress(addr) {
+		return fmt.Errorf("invalid address:%q", addr)
+	}
+	input := lab.SetStateInput{Address: common.HexToAddress(addr)}
+
+	if set.Balance != "" {
+		var s string
+		if s, err = r.expand(set.Balance); err != nil {
+			return
+		}
+		balance, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			return fmt.Errorf("invalid balance:%s", s)
+		}
+		input.State.Balance = (*hexutil.Big)(balance)
+	}
+	input.State.Nonce = set.Nonce
+	if set.Code != "" {
+		var s string
+		if s, err = r.expand(set.Code); err != nil {
+			return
+		}
+		if input.State.Code, err = hexutil.Decode(s); err != nil {
+			return fmt.Errorf("invalid code: %v", err)
+		}
+	}
+	if len(set.Storage) > 0 {
+		input.State.Storage = make(map[common.Hash]common.Hash)
+		for key, value := range set.Storage {
+			var k, v string
+			if k, err = r.expand(key); err != nil {
+				return
+			}
+			if v, err = r.expand(value); err != nil {
+				return
+			}
+			input.State.Storage[common.HexToHash(k)] = common.HexToHash(v)
+		}
+	}
+
+	var output lab.SetStateOutput
+	err = postServer(r.ctx, server.SetStateEndpoint, input, &output)
+	if err != nil {
+		return
+	}
+	if output.ErrMsg != "" {
+		return fmt.Errorf("setState err:%s", output.ErrMsg)
+	}
+	fmt.Printf("[OK] setState %s\n", input.Address.Hex())
+	return
+}
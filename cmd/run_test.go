@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestScenarioExpand(t *testing.T) {
+	r := &scenarioRunner{vars: map[string]string{
+		"Token.address":      "0x00000000000000000000000000000000000000aa",
+		"balanceOf.result.0": "100",
+	}}
+
+	args, err := r.expandArgs([]interface{}{"${Token.address}", 1, []interface{}{"${balanceOf.result.0}", "x"}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, argStrings(args), []string{"0x00000000000000000000000000000000000000aa", "1", "[100, x]"})
+
+	_, err = r.expand("${missing}")
+	assert.Assert(t, err != nil)
+}
+
+func TestSameValue(t *testing.T) {
+	assert.Assert(t, sameValue("0x64", "100"))
+	assert.Assert(t, sameValue("0x00000000000000000000000000000000000000AA", "0x00000000000000000000000000000000000000aa"))
+	assert.Assert(t, !sameValue("1", "2"))
+	assert.Assert(t, sameValue("true", "true"))
+}
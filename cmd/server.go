@@ -3,12 +3,13 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/urfave/cli"
 	"github.com/zhiqiangxu/evm-lab/cmd/flag"
 	"github.com/zhiqiangxu/evm-lab/config"
 	"github.com/zhiqiangxu/evm-lab/server"
+	"github.com/zhiqiangxu/evm-lab/wallet"
 )
 
 // ServerCmd ...
@@ -24,28 +25,48 @@ var serverStartCmd = cli.Command{
 	Name:   "start",
 	Usage:  "trigger start action",
 	Action: serverStart,
-	Flags:  []cli.Flag{flag.ConfigFlag},
+	Flags: []cli.Flag{
+		flag.ConfigFlag,
+		flag.ForkChaindataFlag,
+		flag.ForkDumpFlag,
+		flag.ForkBlockFlag,
+	},
 }
 
 func serverStart(ctx *cli.Context) (err error) {
 
-	file := ctx.String(flag.ConfigFlag.Name)
-	confBytes, err := ioutil.ReadFile(file)
-	if err != nil {
-		err = fmt.Errorf("config file not found:%s", file)
-		return
-	}
-
-	var conf config.Config
-	err = json.Unmarshal(confBytes, &conf)
+	conf, err := loadConfig(ctx)
 	if err != nil {
 		return
 	}
+	applyForkFlags(ctx, &conf)
 
-	confBytes, _ = json.Marshal(conf)
+	confBytes, _ := json.Marshal(conf)
 	fmt.Println("conf", string(confBytes))
+	if conf.DevAccounts != nil {
+		keys, err := wallet.DevKeys(conf.DevAccounts)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			fmt.Println("dev account", i, crypto.PubkeyToAddress(key.PublicKey).Hex())
+		}
+	}
 
 	svr := server.New(conf)
 
 	return svr.Start()
 }
+
+// applyForkFlags overrides the Fork of conf with the flags, if any of them is set.
+func applyForkFlags(ctx *cli.Context, conf *config.Config) {
+	chaindata, dump := ctx.String(flag.ForkChaindataFlag.Name), ctx.String(flag.ForkDumpFlag.Name)
+	if chaindata == "" && dump == "" {
+		return
+	}
+	conf.Fork = &config.Fork{Chaindata: chaindata, Dump: dump}
+	if ctx.IsSet(flag.ForkBlockFlag.Name) {
+		block := ctx.Uint64(flag.ForkBlockFlag.Name)
+		conf.Fork.Block = &block
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/compiler"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+// compileSolidity is compiler.CompileSolidity, except that it also returns the
+// source files that the file indexes of the source maps refer to.
+func compileSolidity(solc string, sourcefiles ...string) (contracts map[string]*compiler.Contract, sources []srcmap.Source, err error) {
+	if solc == "" {
+		solc = "solc"
+	}
+	s, err := compiler.SolidityVersion(solc)
+	if err != nil {
+		return
+	}
+
+	// same as the arguments used by compiler.CompileSolidity
+	args := []string{
+		"--combined-json", "bin,bin-runtime,srcmap,srcmap-runtime,abi,userdoc,devdoc",
+		"--optimize",
+		"--allow-paths", "., ./, ../",
+	}
+	if s.Major > 0 || s.Minor > 4 || s.Patch > 6 {
+		args[1] += ",metadata,hashes"
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.Path, append(append(args, "--"), sourcefiles...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		err = fmt.Errorf("solc: %v\n%s", err, stderr.Bytes())
+		return
+	}
+
+	contracts, err = compiler.ParseCombinedJSON(stdout.Bytes(), "", s.Version, s.Version, strings.Join(args, " "))
+	if err != nil {
+		return
+	}
+
+	var output struct {
+		SourceList []string `json:"sourceList"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return
+	}
+	for _, name := range output.SourceList {
+		// sources that can't be read just won't have lines
+		content, _ := ioutil.ReadFile(name)
+		sources = append(sources, srcmap.Source{Name: name, Content: string(content)})
+	}
+	return
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/config"
+)
+
+var clientExportCmd = cli.Command{
+	Name:   "export",
+	Usage:  "write the lab state as the genesis alloc of the config, to be loaded by server start --cfg",
+	Action: clientExport,
+	Flags: []cli.Flag{
+		flag.OutputFlag,
+		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+var clientImportCmd = cli.Command{
+	Name:      "import",
+	Usage:     "replace the lab state with the genesis alloc of a config file",
+	ArgsUsage: "<config file>",
+	Action:    clientImport,
+	Flags: []cli.Flag{
+		flag.ConfigFlag,
+		flag.ServerFlag,
+		flag.EnvFlag,
+		flag.ClientConfigFlag,
+		flag.WorkspaceFlag,
+	},
+}
+
+// clientExport writes the config of --cfg, with the genesis exported by the server.
+func clientExport(ctx *cli.Context) (err error) {
+	conf, err := loadConfig(ctx)
+	if err != nil {
+		return
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	genesis, err := c.ExportState(context.Background())
+	if err != nil {
+		return
+	}
+	conf.Genesis = genesis
+	// the state forked is in the alloc now
+	conf.Fork = nil
+
+	confBytes, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return
+	}
+	confBytes = append(confBytes, '\n')
+
+	output := ctx.String(flag.OutputFlag.Name)
+	if output == "" {
+		_, err = os.Stdout.Write(confBytes)
+		return
+	}
+	err = ioutil.WriteFile(output, confBytes, 0644)
+	if err != nil {
+		return
+	}
+	fmt.Printf("%d accounts exported to %s\n", len(genesis.Alloc), output)
+	return
+}
+
+func clientImport(ctx *cli.Context) (err error) {
+	if len(ctx.Args()) != 1 {
+		err = fmt.Errorf("exactly one config file expected")
+		return
+	}
+	file := ctx.Args()[0]
+	confBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	var conf config.Config
+	err = json.Unmarshal(confBytes, &conf)
+	if err != nil {
+		err = fmt.Errorf("invalid config %s: %v", file, err)
+		return
+	}
+	if conf.Genesis == nil {
+		err = fmt.Errorf("no Genesis in %s", file)
+		return
+	}
+
+	c, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	err = c.ImportState(context.Background(), conf.Genesis)
+	if err != nil {
+		return
+	}
+	fmt.Printf("%d accounts imported from %s\n", len(conf.Genesis.Alloc), file)
+	return
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/config"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+// TestCmd ...
+var TestCmd = cli.Command{
+	Name:      "test",
+	Usage:     "run the test* functions of the contracts in *.t.sol files with the lab EVM",
+	ArgsUsage: "[file or dir...]",
+	Action:    runTests,
+	Flags: []cli.Flag{
+		flag.SolcFlag,
+		flag.MatchFlag,
+		flag.CoverageFlag,
+		flag.LCOVFlag,
+		flag.HTMLFlag,
+		flag.ConfigFlag,
+	},
+}
+
+const (
+	testPrefix = "test"
+	// tests named testFail* pass only if they revert
+	testFailPrefix = "testFail"
+	setUpMethod    = "setUp"
+	// ds-test records failed assertions instead of reverting
+	failedMethod = "failed"
+)
+
+// testContract is a compiled contract with test functions.
+type testContract struct {
+	compiledContract
+	tests []abi.Method
+}
+
+func runTests(ctx *cli.Context) (err error) {
+	conf, err := loadConfig(ctx)
+	if err != nil {
+		return
+	}
+	conf.Quiet = true
+	conf.Cheatcodes = true
+	conf.Coverage = ctx.Bool(flag.CoverageFlag.Name)
+
+	files, err := findTestFiles(ctx.Args())
+	if err != nil {
+		return
+	}
+	if len(files) == 0 {
+		err = fmt.Errorf("no *.t.sol files found")
+		return
+	}
+
+	var match *regexp.Regexp
+	if ctx.IsSet(flag.MatchFlag.Name) {
+		match, err = regexp.Compile(ctx.String(flag.MatchFlag.Name))
+		if err != nil {
+			return
+		}
+	}
+
+	contracts, err := compileTestContracts(ctx.String(flag.SolcFlag.Name), files, match)
+	if err != nil {
+		return
+	}
+
+	engine, err := lab.NewEngine(conf)
+	if err != nil {
+		return
+	}
+	genesis := engine.Snapshot()
+	sender := testSender(conf)
+
+	var passed, failed int
+	for _, contract := range contracts {
+		fmt.Printf("\nRunning %d tests for %s\n", len(contract.tests), contract.Name)
+
+		// every test contract starts from the genesis state
+		err = engine.Revert(genesis)
+		if err != nil {
+			return
+		}
+		addr, errMsg := setUpTestContract(engine, sender, contract)
+		if errMsg != "" {
+			fmt.Printf("[FAIL. Reason: %s] setUp\n", errMsg)
+			failed += len(contract.tests)
+			continue
+		}
+
+		// and every test starts from the state after setUp
+		setUp := engine.Snapshot()
+		for _, test := range contract.tests {
+			err = engine.Revert(setUp)
+			if err != nil {
+				return
+			}
+
+			output := engine.Call(lab.CallInput{Sender: sender, Receiver: addr, Input: test.ID})
+			reason := output.ErrMsg
+			if reason == "" && assertionFailed(engine, sender, addr, contract) {
+				reason = "assertion failed"
+			}
+
+			if strings.HasPrefix(test.Name, testFailPrefix) {
+				if reason == "" {
+					reason = "expected to fail"
+				} else {
+					reason = ""
+				}
+			}
+
+			if reason == "" {
+				passed++
+				fmt.Printf("[PASS] %s (gas: %d)\n", test.Sig, output.GasUsed)
+			} else {
+				failed++
+				fmt.Printf("[FAIL. Reason: %s] %s (gas: %d)\n", reason, test.Sig, output.GasUsed)
+			}
+			for _, line := range output.Console {
+				fmt.Println("  " + line)
+			}
+		}
+	}
+
+	result := "ok"
+	if failed > 0 {
+		result = "FAILED"
+	}
+	fmt.Printf("\nTest result: %s. %d passed; %d failed\n", result, passed, failed)
+
+	if conf.Coverage {
+		// the coverage of the tests themselves is not interesting
+		var files []*srcmap.FileCoverage
+		for _, file := range engine.Coverage(lab.CoverageInput{}).Files {
+			if !strings.HasSuffix(file.File, ".t.sol") {
+				files = append(files, file)
+			}
+		}
+		fmt.Println()
+		err = writeCoverage(files, ctx.String(flag.LCOVFlag.Name), ctx.String(flag.HTMLFlag.Name))
+		if err != nil {
+			return
+		}
+	}
+
+	if failed > 0 {
+		err = fmt.Errorf("%d tests failed", failed)
+	}
+	return
+}
+
+// findTestFiles returns the files of args, and the *.t.sol files under the dirs of args,
+// the current dir by default.
+func findTestFiles(args []string) (files []string, err error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	for _, arg := range args {
+		var info os.FileInfo
+		info, err = os.Stat(arg)
+		if err != nil {
+			return
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(path, ".t.sol") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// compileTestContracts compiles files, and returns the contracts defined in them with
+// test functions matching match, sorted by name.
+func compileTestContracts(solc string, files []string, match *regexp.Regexp) (contracts []*testContract, err error) {
+	compiled, sources, err := compileSolidity(solc, files...)
+	if err != nil {
+		return
+	}
+
+	var names []string
+	for name := range compiled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := compiled[name]
+		nameParts := strings.Split(name, ":")
+		if !isTestFile(nameParts[0], files) || c.Code == "" || c.Code == "0x" {
+			continue
+		}
+
+		abiBytes, _ := json.Marshal(c.Info.AbiDefinition)
+		var contractABI abi.ABI
+		contractABI, err = abi.JSON(bytes.NewReader(abiBytes))
+		if err != nil {
+			err = fmt.Errorf("abi.JSON err:%v", err)
+			return
+		}
+
+		contract := &testContract{compiledContract: compiledContract{Name: nameParts[len(nameParts)-1], Contract: c, ABI: contractABI, Sources: sources}}
+		for _, method := range contractABI.Methods {
+			if !strings.HasPrefix(method.Name, testPrefix) || len(method.Inputs) > 0 {
+				continue
+			}
+			if match != nil && !match.MatchString(method.Name) {
+				continue
+			}
+			contract.tests = append(contract.tests, method)
+		}
+		if len(contract.tests) == 0 {
+			continue
+		}
+		sort.Slice(contract.tests, func(i, j int) bool { return contract.tests[i].Name < contract.tests[j].Name })
+		contracts = append(contracts, contract)
+	}
+	return
+}
+
+func isTestFile(path string, files []string) bool {
+	for _, file := range files {
+		if filepath.Clean(file) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// testSender is the first funded account of the genesis, the zero address if there is none.
+func testSender(conf config.Config) (sender common.Address) {
+	if conf.Genesis == nil {
+		return
+	}
+	first := true
+	for addr := range conf.Genesis.Alloc {
+		if first || bytes.Compare(addr[:], sender[:]) < 0 {
+			sender = addr
+			first = false
+		}
+	}
+	return
+}
+
+// setUpTestContract deploys contract and calls its setUp if any.
+func setUpTestContract(engine *lab.Engine, sender common.Address, contract *testContract) (addr common.Address, errMsg string) {
+	deployOutput := engine.Deploy(lab.DeployInput{
+		Sender:       sender,
+		CodeAndInput: common.FromHex(contract.Contract.Code),
+		Artifact:     contract.artifact(),
+	})
+	if deployOutput.ErrMsg != "" {
+		return addr, deployOutput.ErrMsg
+	}
+	addr = deployOutput.Addr
+
+	if method, ok := contract.ABI.Methods[setUpMethod]; ok {
+		callOutput := engine.Call(lab.CallInput{Sender: sender, Receiver: addr, Input: method.ID})
+		errMsg = callOutput.ErrMsg
+	}
+	return
+}
+
+// assertionFailed checks the failed() flag of ds-test style contracts.
+func assertionFailed(engine *lab.Engine, sender, addr common.Address, contract *testContract) bool {
+	method, ok := contract.ABI.Methods[failedMethod]
+	if !ok || len(method.Inputs) > 0 || len(method.Outputs) != 1 {
+		return false
+	}
+
+	output := engine.Call(lab.CallInput{Sender: sender, Receiver: addr, Input: method.ID})
+	if output.ErrMsg != "" {
+		return false
+	}
+	values, err := method.Outputs.Unpack(output.Result)
+	if err != nil || len(values) != 1 {
+		return false
+	}
+	failed, _ := values[0].(bool)
+	return failed
+}
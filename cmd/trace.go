@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/websocket"
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/evm-lab/server"
+)
+
+var traceFilterFlags = []cli.Flag{
+	flag.OpsFlag,
+	flag.MinDepthFlag,
+	flag.MaxDepthFlag,
+	flag.AddressesFlag,
+	flag.StackFlag,
+}
+
+var clientTraceCmd = cli.Command{
+	Name:  "trace",
+	Usage: "stream the trace of a deploy or call as json lines, on a copy of the lab state",
+	Subcommands: []cli.Command{
+		{
+			Name:   "deploy",
+			Usage:  "trace a deploy",
+			Action: clientTraceDeploy,
+			Flags:  append(append([]cli.Flag{}, clientDeployCmd.Flags...), traceFilterFlags...),
+		},
+		{
+			Name:   "call",
+			Usage:  "trace a call",
+			Action: clientTraceCall,
+			Flags:  append(append([]cli.Flag{}, clientCallCmd.Flags...), traceFilterFlags...),
+		},
+	},
+}
+
+func clientTraceDeploy(ctx *cli.Context) (err error) {
+	input, err := buildDeployInput(ctx)
+	if err != nil {
+		return
+	}
+
+	return clientTrace(ctx, lab.TraceInput{Deploy: &input})
+}
+
+func clientTraceCall(ctx *cli.Context) (err error) {
+	input, err := buildCallInput(ctx)
+	if err != nil {
+		return
+	}
+
+	return clientTrace(ctx, lab.TraceInput{Call: &input})
+}
+
+func clientTrace(ctx *cli.Context, input lab.TraceInput) (err error) {
+	input.Filter = lab.TraceFilter{
+		MinDepth: ctx.Int(flag.MinDepthFlag.Name),
+		MaxDepth: ctx.Int(flag.MaxDepthFlag.Name),
+		Stack:    ctx.Bool(flag.StackFlag.Name),
+	}
+	input.Filter.Ops = splitList(ctx.String(flag.OpsFlag.Name))
+	for _, addr := range splitList(ctx.String(flag.AddressesFlag.Name)) {
+		if !common.IsHexAddress(addr) {
+			err = fmt.Errorf("invalid address:%s", addr)
+			return
+		}
+		input.Filter.Addresses = append(input.Filter.Addresses, common.HexToAddress(addr))
+	}
+
+	env, err := labEnv(ctx)
+	if err != nil {
+		return
+	}
+	// http becomes ws, https wss
+	header := make(http.Header)
+	if env.Workspace != "" {
+		header.Set(server.WorkspaceHeader, env.Workspace)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(env.Server, "http")+server.TraceWSEndpoint, header)
+	if err != nil {
+		err = fmt.Errorf("API err:%v", err)
+		return
+	}
+	defer conn.Close()
+
+	err = conn.WriteJSON(input)
+	if err != nil {
+		return
+	}
+
+	// the events are printed as they come, the last one is the result
+	for {
+		var event lab.TraceEvent
+		err = conn.ReadJSON(&event)
+		if err != nil {
+			return
+		}
+		eventBytes, _ := json.Marshal(event)
+		fmt.Println(string(eventBytes))
+		if event.End != nil {
+			return
+		}
+	}
+}
+
+// splitList splits a comma separated flag value, ignoring the empty items.
+func splitList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli"
+	"github.com/zhiqiangxu/evm-lab/cmd/flag"
+	"github.com/zhiqiangxu/evm-lab/server"
+)
+
+var workspaceServerFlags = []cli.Flag{
+	flag.ConfigFlag,
+	flag.ServerFlag,
+	flag.EnvFlag,
+	flag.ClientConfigFlag,
+}
+
+var clientWorkspaceCmd = cli.Command{
+	Name:  "workspace",
+	Usage: "manage the isolated lab states of the server, the other client commands pick one with --workspace",
+	Subcommands: []cli.Command{
+		{
+			Name:      "create",
+			Usage:     "create a workspace from the genesis, or from the state of another workspace",
+			ArgsUsage: "<name>",
+			Action:    clientWorkspaceCreate,
+			Flags:     append([]cli.Flag{flag.SourceFlag, flag.SnapshotFlag}, workspaceServerFlags...),
+		},
+		{
+			Name:      "delete",
+			Usage:     "delete a workspace",
+			ArgsUsage: "<name>",
+			Action:    clientWorkspaceDelete,
+			Flags:     workspaceServerFlags,
+		},
+		{
+			Name:   "list",
+			Usage:  "list the workspaces",
+			Action: clientWorkspaceList,
+			Flags:  workspaceServerFlags,
+		},
+	},
+}
+
+func workspaceName(ctx *cli.Context) (name string, err error) {
+	if len(ctx.Args()) != 1 {
+		err = fmt.Errorf("exactly one workspace name expected")
+		return
+	}
+	name = ctx.Args()[0]
+	return
+}
+
+func clientWorkspaceCreate(ctx *cli.Context) (err error) {
+	name, err := workspaceName(ctx)
+	if err != nil {
+		return
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	err = c.CreateWorkspace(context.Background(), server.WorkspaceCreateInput{
+		Name:     name,
+		Source:   ctx.String(flag.SourceFlag.Name),
+		Snapshot: ctx.Uint64(flag.SnapshotFlag.Name),
+	})
+	if err != nil {
+		return
+	}
+	fmt.Printf("workspace %s created\n", name)
+	return
+}
+
+func clientWorkspaceDelete(ctx *cli.Context) (err error) {
+	name, err := workspaceName(ctx)
+	if err != nil {
+		return
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	err = c.DeleteWorkspace(context.Background(), name)
+	if err != nil {
+		return
+	}
+	fmt.Printf("workspace %s deleted\n", name)
+	return
+}
+
+func clientWorkspaceList(ctx *cli.Context) (err error) {
+	c, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	names, err := c.Workspaces(context.Background())
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return
+}
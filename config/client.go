@@ -0,0 +1,18 @@
+package config
+
+// ClientConfig has the lab servers a client can target, by env name
+type ClientConfig struct {
+	// env used when none is specified
+	Default string
+	Envs    map[string]Env
+}
+
+// Env is a lab server
+type Env struct {
+	// url of the server, e.g. http://10.0.0.2:8080
+	Server string
+	// workspace of the server, the default one when empty
+	Workspace string
+	// timeout of every request in seconds, no limit when 0
+	Timeout int
+}
@@ -1,6 +1,9 @@
 package config
 
-import "github.com/ethereum/go-ethereum/core"
+import (
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+)
 
 // Config ...
 type Config struct {
@@ -16,4 +19,35 @@ type Config struct {
 	Debug             bool
 	Dump              bool
 	StatDump          bool
+	// don't print the result of every tx, for running the lab in process
+	Quiet bool
+	// install the foundry cheatcodes at HEVM_ADDRESS
+	Cheatcodes bool
+	// record the executed instructions of the deploys and calls for the coverage report
+	Coverage bool
+	// seed the state from an existing chain, Genesis.Alloc being set over it
+	Fork *Fork `json:",omitempty"`
+	// fund the accounts of a mnemonic at genesis, Genesis.Alloc being set over them
+	DevAccounts *DevAccounts `json:",omitempty"`
+}
+
+// DevAccounts are the first Count accounts of Mnemonic along HDPath
+type DevAccounts struct {
+	Mnemonic string
+	// m/44'/60'/0'/0/0 by default, the following accounts incrementing the last component
+	HDPath string `json:",omitempty"`
+	// 10 by default
+	Count int `json:",omitempty"`
+	// in wei, 10000 ether by default
+	Balance *math.HexOrDecimal256 `json:",omitempty"`
+}
+
+// Fork has the chain state the lab starts from, exactly one of Chaindata and Dump should be set
+type Fork struct {
+	// geth chaindata directory, e.g. <datadir>/geth/chaindata, read lazily and never written
+	Chaindata string
+	// file of geth dump, loaded at start
+	Dump string
+	// block of Chaindata to fork from, the head by default
+	Block *uint64
 }
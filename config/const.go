@@ -2,3 +2,6 @@ package config
 
 // ConfigJSON ...
 const ConfigJSON = "config.json"
+
+// ClientConfigJSON ...
+const ClientConfigJSON = "client.json"
@@ -5,7 +5,11 @@ go 1.15
 require (
 	github.com/ethereum/go-ethereum v1.10.17-0.20220315112003-dbfd3972624c
 	github.com/gin-gonic/gin v1.6.3
+	github.com/gorilla/websocket v1.4.2
+	github.com/peterh/liner v1.1.1-0.20190123174540-a2c9a5303de7
+	github.com/tyler-smith/go-bip39 v1.0.1-0.20181017060643-dbb3b84ba2ef
 	github.com/urfave/cli v1.22.5
 	github.com/zhiqiangxu/util v0.0.0-20210114025214-5f087283a7a6
+	gopkg.in/yaml.v2 v2.4.0
 	gotest.tools v2.2.0+incompatible
 )
@@ -0,0 +1,64 @@
+package lab
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+)
+
+// handleCreateAccessList runs the call against copies of the state until the touched
+// addresses and slots no longer change, the same way eth_createAccessList does.
+func (e *Engine) handleCreateAccessList(input CallInput) (output AccessListOutput) {
+	precompiles := vm.ActivePrecompiles(e.block().rules())
+
+	// gas used with the access list of the input, as the baseline
+	gasUsed, _, err := e.traceAccessList(input, input.AccessList, precompiles)
+	if err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+	output.GasUsedWithInputList = gasUsed
+
+	prevTracer := logger.NewAccessListTracer(input.AccessList, input.Sender, input.Receiver, precompiles)
+	for {
+		accessList := prevTracer.AccessList()
+		gasUsed, tracer, err := e.traceAccessList(input, accessList, precompiles)
+		if err != nil {
+			output.ErrMsg = err.Error()
+			return
+		}
+		if tracer.Equal(prevTracer) {
+			output.AccessList = accessList
+			output.GasUsed = gasUsed
+			output.GasSaved = int64(output.GasUsedWithInputList) - int64(output.GasUsed)
+			return
+		}
+		prevTracer = tracer
+	}
+}
+
+// traceAccessList runs the call with accessList on a copy of the state, and returns the gas used,
+// including the intrinsic gas, together with the tracer that recorded the touched addresses and slots.
+func (e *Engine) traceAccessList(input CallInput, accessList types.AccessList, precompiles []common.Address) (uint64, *logger.AccessListTracer, error) {
+	tracer := logger.NewAccessListTracer(accessList, input.Sender, input.Receiver, precompiles)
+
+	block := e.block()
+	execGas, intrinsicGas, err := block.buyGas(input.Gas, input.Input, accessList, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	runtimeConfig, err := block.newRuntimeConfig(e.statedb.Copy(), input.Sender, execGas, input.Value, input.GasPrice, input.MaxFeePerGas, input.MaxPriorityFeePerGas, accessList, tracer)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	outputBytes, leftOverGas, err := applyCall(runtimeConfig, input.Receiver, input.Input, accessList)
+	if err != nil {
+		return 0, nil, errors.New(parseRevertReason(err, outputBytes))
+	}
+	return intrinsicGas + execGas - leftOverGas, tracer, nil
+}
@@ -0,0 +1,394 @@
+package lab
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// HEVMAddress is where the cheatcodes live, same as foundry: address(bytes20(uint160(uint256(keccak256('hevm cheat code')))))
+var HEVMAddress = common.HexToAddress("0x7109709ECfa91a80626fF3989D68f67F5b1DD12D")
+
+// hevmCode is the stub installed at HEVMAddress, the cheatcodes tracer fills in its result at the JUMPI:
+//
+//	PUSH1 size PUSH1 offset PUSH1 ok PUSH1 0x0a JUMPI REVERT JUMPDEST RETURN
+var hevmCode = common.FromHex("0x600060006000600a57fd5bf3")
+
+const hevmJumpPC = 8
+
+const cheatcodesABIJSON = `[
+	{"type":"function","name":"warp","inputs":[{"type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"roll","inputs":[{"type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"deal","inputs":[{"type":"address"},{"type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"prank","inputs":[{"type":"address"}],"outputs":[]},
+	{"type":"function","name":"prank","inputs":[{"type":"address"},{"type":"address"}],"outputs":[]},
+	{"type":"function","name":"startPrank","inputs":[{"type":"address"}],"outputs":[]},
+	{"type":"function","name":"startPrank","inputs":[{"type":"address"},{"type":"address"}],"outputs":[]},
+	{"type":"function","name":"stopPrank","inputs":[],"outputs":[]},
+	{"type":"function","name":"store","inputs":[{"type":"address"},{"type":"bytes32"},{"type":"bytes32"}],"outputs":[]},
+	{"type":"function","name":"load","inputs":[{"type":"address"},{"type":"bytes32"}],"outputs":[{"type":"bytes32"}]},
+	{"type":"function","name":"expectRevert","inputs":[],"outputs":[]},
+	{"type":"function","name":"expectRevert","inputs":[{"type":"bytes"}],"outputs":[]},
+	{"type":"function","name":"expectRevert","inputs":[{"type":"bytes4"}],"outputs":[]},
+	{"type":"function","name":"expectEmit","inputs":[{"type":"bool"},{"type":"bool"},{"type":"bool"},{"type":"bool"}],"outputs":[]},
+	{"type":"function","name":"expectEmit","inputs":[{"type":"bool"},{"type":"bool"},{"type":"bool"},{"type":"bool"},{"type":"address"}],"outputs":[]},
+	{"type":"function","name":"etch","inputs":[{"type":"address"},{"type":"bytes"}],"outputs":[]},
+	{"type":"function","name":"snapshot","inputs":[],"outputs":[{"type":"uint256"}]},
+	{"type":"function","name":"revertTo","inputs":[{"type":"uint256"}],"outputs":[{"type":"bool"}]},
+	{"type":"function","name":"label","inputs":[{"type":"address"},{"type":"string"}],"outputs":[]}
+]`
+
+var cheatcodesABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(cheatcodesABIJSON))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+type prank struct {
+	sender common.Address
+	origin *common.Address
+	// the calls made by caller at depth are pranked
+	caller     common.Address
+	depth      int
+	persistent bool
+}
+
+type expectedRevert struct {
+	// nil matches any revert data
+	data   []byte
+	caller common.Address
+	depth  int
+}
+
+type expectedEmit struct {
+	checkTopics [3]bool
+	checkData   bool
+	emitter     *common.Address
+	caller      common.Address
+	depth       int
+	// the log emitted by the test right after expectEmit
+	log *logEntry
+	// whether the next call of the test emitted a matching log
+	found bool
+}
+
+type logEntry struct {
+	address common.Address
+	topics  []common.Hash
+	data    []byte
+}
+
+type cheatFrame struct {
+	frame
+	// the journal revision right after the frame was entered
+	revision int
+	prank    *prank
+	// the origin to restore once the pranked frame exits
+	prevOrigin     *common.Address
+	prankApplied   bool
+	expectedRevert *expectedRevert
+	expectedEmit   *expectedEmit
+}
+
+// cheatcodes implements the foundry cheatcodes: the calls to HEVMAddress run the stub
+// of hevmCode, which is intercepted at its JUMPI to execute the cheatcode and fill in
+// the result. The cheatcodes affecting other calls are applied as those calls are traced.
+type cheatcodes struct {
+	sources *sourceMaps
+	env     *vm.EVM
+	frames  []*cheatFrame
+
+	prank          *prank
+	expectedRevert *expectedRevert
+	expectedEmit   *expectedEmit
+	// the caller depth at which the CALL result should be flipped to success,
+	// after an expected revert
+	flipSuccess int
+
+	// the journal revisions of the snapshot cheatcode by id
+	snapshots []int
+
+	// the first failed expectation, which fails the tx
+	failure string
+}
+
+func newCheatcodes(sources *sourceMaps) *cheatcodes {
+	return &cheatcodes{sources: sources}
+}
+
+func (c *cheatcodes) fail(format string, args ...interface{}) {
+	if c.failure == "" {
+		c.failure = fmt.Sprintf(format, args...)
+	}
+}
+
+// execute runs the cheatcode of input called by caller, at callerDepth.
+func (c *cheatcodes) execute(caller common.Address, callerDepth int, input []byte) ([]byte, error) {
+	if len(input) < 4 {
+		return nil, fmt.Errorf("cheatcode input too short")
+	}
+	method, err := cheatcodesABI.MethodById(input[:4])
+	if err != nil {
+		return nil, fmt.Errorf("unknown cheatcode 0x%x", input[:4])
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method.Sig, err)
+	}
+
+	statedb := c.env.StateDB
+	switch method.Sig {
+	case "warp(uint256)":
+		c.env.Context.Time = new(big.Int).Set(args[0].(*big.Int))
+	case "roll(uint256)":
+		c.env.Context.BlockNumber = new(big.Int).Set(args[0].(*big.Int))
+	case "deal(address,uint256)":
+		addr := args[0].(common.Address)
+		statedb.SubBalance(addr, statedb.GetBalance(addr))
+		statedb.AddBalance(addr, args[1].(*big.Int))
+	case "prank(address)", "startPrank(address)":
+		c.prank = &prank{sender: args[0].(common.Address), caller: caller, depth: callerDepth, persistent: method.RawName == "startPrank"}
+	case "prank(address,address)", "startPrank(address,address)":
+		origin := args[1].(common.Address)
+		c.prank = &prank{sender: args[0].(common.Address), origin: &origin, caller: caller, depth: callerDepth, persistent: method.RawName == "startPrank"}
+	case "stopPrank()":
+		c.prank = nil
+	case "store(address,bytes32,bytes32)":
+		statedb.SetState(args[0].(common.Address), args[1].([32]byte), args[2].([32]byte))
+	case "load(address,bytes32)":
+		value := statedb.GetState(args[0].(common.Address), args[1].([32]byte))
+		return method.Outputs.Pack(value)
+	case "expectRevert()":
+		c.expectedRevert = &expectedRevert{caller: caller, depth: callerDepth}
+	case "expectRevert(bytes)":
+		c.expectedRevert = &expectedRevert{data: common.CopyBytes(args[0].([]byte)), caller: caller, depth: callerDepth}
+	case "expectRevert(bytes4)":
+		selector := args[0].([4]byte)
+		c.expectedRevert = &expectedRevert{data: selector[:], caller: caller, depth: callerDepth}
+	case "expectEmit(bool,bool,bool,bool)", "expectEmit(bool,bool,bool,bool,address)":
+		c.expectedEmit = &expectedEmit{
+			checkTopics: [3]bool{args[0].(bool), args[1].(bool), args[2].(bool)},
+			checkData:   args[3].(bool),
+			caller:      caller,
+			depth:       callerDepth,
+		}
+		if len(args) == 5 {
+			emitter := args[4].(common.Address)
+			c.expectedEmit.emitter = &emitter
+		}
+	case "etch(address,bytes)":
+		statedb.SetCode(args[0].(common.Address), common.CopyBytes(args[1].([]byte)))
+	case "snapshot()":
+		c.snapshots = append(c.snapshots, statedb.Snapshot())
+		return method.Outputs.Pack(big.NewInt(int64(len(c.snapshots) - 1)))
+	case "revertTo(uint256)":
+		return method.Outputs.Pack(c.revertTo(args[0].(*big.Int), c.frames[callerDepth-1]))
+	case "label(address,string)":
+		c.sources.label(args[0].(common.Address), args[1].(string))
+	default:
+		return nil, fmt.Errorf("cheatcode %s not supported", method.Sig)
+	}
+	return nil, nil
+}
+
+// revertTo reverts the journal to the snapshot id, which can be reverted to again. Reverting the
+// journal drops the later revisions, so a snapshot taken before caller was entered is refused:
+// the revisions of caller and of the frames it called would be gone, which they revert to when
+// they fail.
+func (c *cheatcodes) revertTo(id *big.Int, caller *cheatFrame) (ok bool) {
+	if !id.IsUint64() || id.Uint64() >= uint64(len(c.snapshots)) {
+		return false
+	}
+	revision := c.snapshots[id.Uint64()]
+	if revision < caller.revision {
+		return false
+	}
+	// RevertToSnapshot panics if the snapshot was dropped already, by a frame which failed
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	c.env.StateDB.RevertToSnapshot(revision)
+	c.snapshots[id.Uint64()] = c.env.StateDB.Snapshot()
+	return true
+}
+
+// enter applies the pending prank and expectations to a call made by the test.
+func (c *cheatcodes) enter(f *cheatFrame) {
+	callerDepth := len(c.frames)
+	c.frames = append(c.frames, f)
+	if f.to == HEVMAddress {
+		return
+	}
+
+	if p := c.prank; p != nil && p.depth == callerDepth && p.caller == f.from {
+		f.prank = p
+		if !p.persistent {
+			c.prank = nil
+		}
+	}
+	if e := c.expectedRevert; e != nil && e.depth == callerDepth && e.caller == f.from && !f.create {
+		f.expectedRevert = e
+		c.expectedRevert = nil
+	}
+	if e := c.expectedEmit; e != nil && e.log != nil && e.depth == callerDepth && e.caller == f.from {
+		f.expectedEmit = e
+		c.expectedEmit = nil
+	}
+}
+
+func (c *cheatcodes) exit(output []byte, err error) {
+	if len(c.frames) == 0 {
+		return
+	}
+	f := c.frames[len(c.frames)-1]
+	c.frames = c.frames[:len(c.frames)-1]
+
+	if f.prevOrigin != nil {
+		c.env.Origin = *f.prevOrigin
+	}
+	if e := f.expectedRevert; e != nil {
+		switch {
+		case err == nil:
+			c.fail("call did not revert as expected")
+		case e.data != nil && !bytes.Equal(e.data, output) && !(len(e.data) == 4 && bytes.HasPrefix(output, e.data)):
+			c.fail("call reverted with 0x%x instead of 0x%x", output, e.data)
+		default:
+			// the caller sees a successful call
+			c.flipSuccess = len(c.frames)
+		}
+	}
+	if e := f.expectedEmit; e != nil && !e.found {
+		c.fail("expected event not emitted")
+	}
+}
+
+func (c *cheatcodes) log(op vm.OpCode, scope *vm.ScopeContext, depth int) {
+	stack := scope.Stack
+	if len(stack.Data()) < 2+int(op-vm.LOG0) {
+		return
+	}
+	entry := &logEntry{
+		address: scope.Contract.Address(),
+		data:    scope.Memory.GetCopy(int64(stack.Back(0).Uint64()), int64(stack.Back(1).Uint64())),
+	}
+	for i := 0; i < int(op-vm.LOG0); i++ {
+		entry.topics = append(entry.topics, common.Hash(stack.Back(2+i).Bytes32()))
+	}
+
+	// the first log of the test after expectEmit is the expected one
+	if e := c.expectedEmit; e != nil && e.log == nil && depth == e.depth && entry.address == e.caller {
+		e.log = entry
+		return
+	}
+	for _, f := range c.frames {
+		if e := f.expectedEmit; e != nil && !e.found && e.matches(entry) {
+			e.found = true
+		}
+	}
+}
+
+func (e *expectedEmit) matches(entry *logEntry) bool {
+	if e.emitter != nil && *e.emitter != entry.address {
+		return false
+	}
+	if len(entry.topics) != len(e.log.topics) {
+		return false
+	}
+	for i := range entry.topics {
+		// topic 0 is the event signature, which is always checked
+		if (i == 0 || e.checkTopics[i-1]) && entry.topics[i] != e.log.topics[i] {
+			return false
+		}
+	}
+	return !e.checkData || bytes.Equal(entry.data, e.log.data)
+}
+
+func (c *cheatcodes) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	c.env = env
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	c.frames = append(c.frames, &cheatFrame{frame: frame{typ: typ, from: from, to: to, create: create}, revision: env.StateDB.Snapshot()})
+}
+
+func (c *cheatcodes) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil || len(c.frames) == 0 {
+		return
+	}
+	f := c.frames[len(c.frames)-1]
+
+	if c.flipSuccess != 0 && c.flipSuccess == len(c.frames) {
+		// the result of the CALL that reverted as expected
+		scope.Stack.Back(0).SetOne()
+		c.flipSuccess = 0
+	}
+
+	if f.prank != nil && !f.prankApplied {
+		scope.Contract.CallerAddress = f.prank.sender
+		if f.prank.origin != nil {
+			origin := c.env.Origin
+			f.prevOrigin = &origin
+			c.env.Origin = *f.prank.origin
+		}
+		f.prankApplied = true
+	}
+
+	if op >= vm.LOG0 && op <= vm.LOG4 {
+		c.log(op, scope, depth)
+	}
+
+	if op == vm.JUMPI && pc == hevmJumpPC && scope.Contract.Address() == HEVMAddress {
+		// the caller of the stub is the frame below it
+		result, err := c.execute(scope.Contract.Caller(), len(c.frames)-1, scope.Contract.Input)
+		ok := uint64(1)
+		if err != nil {
+			result, ok = revertData(err.Error()), 0
+		}
+		if len(result) > 0 {
+			scope.Memory.Resize(uint64((len(result) + 31) / 32 * 32))
+			scope.Memory.Set(0, uint64(len(result)), result)
+		}
+		// stack: size offset ok dest
+		scope.Stack.Back(1).SetUint64(ok)
+		scope.Stack.Back(3).SetUint64(uint64(len(result)))
+	}
+}
+
+func (c *cheatcodes) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	c.enter(&cheatFrame{frame: frame{typ: typ, from: from, to: to, create: isCreate(typ)}, revision: c.env.StateDB.Snapshot()})
+}
+
+func (c *cheatcodes) CaptureExit(output []byte, gasUsed uint64, err error) {
+	c.exit(output, err)
+}
+
+func (c *cheatcodes) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (c *cheatcodes) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	c.exit(output, err)
+	if c.expectedRevert != nil {
+		c.fail("expectRevert without a following call")
+	}
+	if c.expectedEmit != nil {
+		c.fail("expectEmit without a following call")
+	}
+}
+
+// revertData encodes msg as Error(string), the same as require does.
+func revertData(msg string) []byte {
+	stringTy, _ := abi.NewType("string", "", nil)
+	data, _ := abi.Arguments{{Type: stringTy}}.Pack(msg)
+	return append(common.FromHex("0x08c379a0"), data...)
+}
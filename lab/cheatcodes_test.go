@@ -0,0 +1,74 @@
+package lab
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/zhiqiangxu/evm-lab/config"
+	"gotest.tools/assert"
+)
+
+// snapshotRuntime takes a snapshot and sets slot 0, then calls itself with the snapshot id, which
+// reverts with the result of revertTo(id). Then it reverts to the snapshot twice, setting slot 0 in
+// between, and returns the three results of revertTo and slot 0.
+var snapshotRuntime = common.FromHex("3660e0577f9711715a0000000000000000000000000000000000000000000000000000000060005260206020600460006000737109709ecfa91a80626ff3989d68f67f5b1dd12d5af15060016000556020610100602060206000305af1507f44d7f0a4000000000000000000000000000000000000000000000000000000006080526020516084526020610120602460806000737109709ecfa91a80626ff3989d68f67f5b1dd12d5af15060026000556020610140602460806000737109709ecfa91a80626ff3989d68f67f5b1dd12d5af150600054610160526080610100f35b7f44d7f0a40000000000000000000000000000000000000000000000000000000060005260003560045260206000602460006000737109709ecfa91a80626ff3989d68f67f5b1dd12d5af15060206000fd")
+
+func TestHEVMCode(t *testing.T) {
+	assert.Equal(t, vm.OpCode(hevmCode[hevmJumpPC]), vm.JUMPI)
+	assert.Equal(t, vm.OpCode(hevmCode[0x0a]), vm.JUMPDEST)
+}
+
+func TestExpectedEmitMatches(t *testing.T) {
+	topic := common.HexToHash("0x01")
+	expected := &expectedEmit{
+		checkTopics: [3]bool{true, false, false},
+		checkData:   true,
+		log: &logEntry{
+			topics: []common.Hash{topic, common.HexToHash("0x02"), common.HexToHash("0x03")},
+			data:   []byte{1},
+		},
+	}
+
+	entry := &logEntry{topics: []common.Hash{topic, common.HexToHash("0x02"), common.HexToHash("0x04")}, data: []byte{1}}
+	assert.Assert(t, expected.matches(entry), "unchecked topic should be ignored")
+
+	entry.topics[1] = common.HexToHash("0x05")
+	assert.Assert(t, !expected.matches(entry), "checked topic should differ")
+
+	entry.topics[1] = common.HexToHash("0x02")
+	entry.data = []byte{2}
+	assert.Assert(t, !expected.matches(entry), "checked data should differ")
+
+	emitter := common.HexToAddress("0x01")
+	expected.emitter = &emitter
+	entry.data = []byte{1}
+	assert.Assert(t, !expected.matches(entry), "emitter should differ")
+}
+
+func TestCheatcodesSnapshot(t *testing.T) {
+	addr := common.HexToAddress("0x01000000")
+	engine, err := NewEngine(config.Config{
+		Quiet:      true,
+		Cheatcodes: true,
+		Genesis: &core.Genesis{
+			GasLimit: 10000000,
+			Alloc: core.GenesisAlloc{
+				testSenderAddr: {Balance: new(big.Int).Mul(big.NewInt(1e9), big.NewInt(1e18))},
+				addr:           {Code: snapshotRuntime},
+			},
+		},
+	})
+	assert.NilError(t, err)
+
+	output := engine.Call(CallInput{Sender: testSenderAddr, Receiver: addr})
+	assert.Equal(t, output.ErrMsg, "")
+	assert.Equal(t, len(output.Result), 4*32)
+	word := func(i int) uint64 { return new(big.Int).SetBytes(output.Result[i*32 : (i+1)*32]).Uint64() }
+	assert.Equal(t, word(0), uint64(0), "the nested call entered after the snapshot can't revert to it")
+	assert.Equal(t, word(1), uint64(1))
+	assert.Equal(t, word(2), uint64(1), "the snapshot can be reverted to again")
+	assert.Equal(t, word(3), uint64(0))
+}
@@ -0,0 +1,220 @@
+package lab
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ConsoleAddress is where hardhat's console.sol sends its static calls: address(bytes20(bytes("console.log")))
+var ConsoleAddress = common.HexToAddress("0x000000000000000000636F6e736F6c652e6c6f67")
+
+// consoleMethods are the arguments of the console.sol overloads, by selector.
+var consoleMethods = func() map[[4]byte]abi.Arguments {
+	methods := make(map[[4]byte]abi.Arguments)
+	add := func(name string, types ...string) {
+		var args abi.Arguments
+		for _, t := range types {
+			typ, err := abi.NewType(t, "", nil)
+			if err != nil {
+				panic(err)
+			}
+			args = append(args, abi.Argument{Type: typ})
+		}
+		sig := fmt.Sprintf("%s(%s)", name, strings.Join(types, ","))
+		// older versions of console.sol hash uint and int instead of uint256 and int256
+		legacy := strings.NewReplacer("uint256", "uint", "int256", "int").Replace(sig)
+		for _, s := range []string{sig, legacy} {
+			var selector [4]byte
+			copy(selector[:], crypto.Keccak256([]byte(s)))
+			methods[selector] = args
+		}
+	}
+
+	add("log")
+	add("logInt", "int256")
+	add("logUint", "uint256")
+	add("logString", "string")
+	add("logBool", "bool")
+	add("logAddress", "address")
+	add("logBytes", "bytes")
+	for i := 1; i <= 32; i++ {
+		add(fmt.Sprintf("logBytes%d", i), fmt.Sprintf("bytes%d", i))
+	}
+	add("log", "int256")
+	add("log", "bytes")
+
+	// log with 1 to 4 arguments of these types, in any combination
+	types := []string{"uint256", "string", "bool", "address"}
+	var combine func(prefix []string)
+	combine = func(prefix []string) {
+		if len(prefix) > 0 {
+			add("log", prefix...)
+		}
+		if len(prefix) == 4 {
+			return
+		}
+		for _, t := range types {
+			combine(append(append([]string{}, prefix...), t))
+		}
+	}
+	combine(nil)
+	return methods
+}()
+
+// decodeConsoleLog decodes the input of a call to ConsoleAddress into the printed line.
+func decodeConsoleLog(input []byte) (string, error) {
+	if len(input) < 4 {
+		return "", fmt.Errorf("console.log input too short: 0x%x", input)
+	}
+	var selector [4]byte
+	copy(selector[:], input)
+	args, ok := consoleMethods[selector]
+	if !ok {
+		return "", fmt.Errorf("unknown console.log selector: 0x%x", selector)
+	}
+	values, err := args.Unpack(input[4:])
+	if err != nil {
+		return "", fmt.Errorf("console.log decode err:%v", err)
+	}
+	return consoleFormat(values), nil
+}
+
+func formatConsoleValue(value interface{}) string {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case string:
+		return v
+	case bool:
+		return fmt.Sprint(v)
+	case common.Address:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	default:
+		// bytes1 to bytes32 are byte arrays
+		return fmt.Sprintf("0x%x", v)
+	}
+}
+
+// consoleFormat prints values separated by spaces. Like hardhat, when the first value is a
+// string followed by other values, its %s, %d, %i and %o are replaced by the following values,
+// and %% is a literal %.
+func consoleFormat(values []interface{}) string {
+	if len(values) == 0 {
+		return ""
+	}
+	if len(values) == 1 {
+		return formatConsoleValue(values[0])
+	}
+
+	var (
+		b    strings.Builder
+		rest = values
+	)
+	if format, ok := values[0].(string); ok {
+		rest = values[1:]
+		for i := 0; i < len(format); i++ {
+			if format[i] != '%' || i+1 == len(format) {
+				b.WriteByte(format[i])
+				continue
+			}
+			switch format[i+1] {
+			case 's', 'd', 'i', 'o':
+				if len(rest) == 0 {
+					b.WriteByte(format[i])
+					continue
+				}
+				b.WriteString(formatConsoleValue(rest[0]))
+				rest = rest[1:]
+			case '%':
+				b.WriteByte('%')
+			default:
+				b.WriteByte(format[i])
+				continue
+			}
+			i++
+		}
+	} else {
+		b.WriteString(formatConsoleValue(values[0]))
+		rest = values[1:]
+	}
+
+	for _, value := range rest {
+		b.WriteByte(' ')
+		b.WriteString(formatConsoleValue(value))
+	}
+	return b.String()
+}
+
+// consoleLine is a console.log line, printed after step steps of the tx.
+type consoleLine struct {
+	step int
+	text string
+}
+
+// consoleTracer collects the console.log lines of a tx, counting the steps the same way
+// as the struct logger, so that the lines can be interleaved with the trace.
+type consoleTracer struct {
+	steps int
+	lines []consoleLine
+}
+
+func newConsoleTracer() *consoleTracer {
+	return &consoleTracer{}
+}
+
+// texts returns the lines printed by the tx, nil if there is none.
+// It is safe to call on a nil tracer, as is printed.
+func (t *consoleTracer) texts() (texts []string) {
+	if t == nil {
+		return
+	}
+	for _, line := range t.lines {
+		texts = append(texts, line.text)
+	}
+	return
+}
+
+// printed returns the lines with their steps.
+func (t *consoleTracer) printed() []consoleLine {
+	if t == nil {
+		return nil
+	}
+	return t.lines
+}
+
+func (t *consoleTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *consoleTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.steps++
+}
+
+func (t *consoleTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if to != ConsoleAddress {
+		return
+	}
+	text, err := decodeConsoleLog(input)
+	if err != nil {
+		text = err.Error()
+	}
+	t.lines = append(t.lines, consoleLine{step: t.steps, text: text})
+}
+
+func (t *consoleTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+}
+
+func (t *consoleTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *consoleTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+}
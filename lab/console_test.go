@@ -0,0 +1,20 @@
+package lab
+
+import (
+	"math/big"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestConsoleFormat(t *testing.T) {
+	assert.Equal(t, consoleFormat(nil), "")
+	assert.Equal(t, consoleFormat([]interface{}{"100%"}), "100%")
+	assert.Equal(t, consoleFormat([]interface{}{"%% %s"}), "%% %s")
+	assert.Equal(t, consoleFormat([]interface{}{big.NewInt(42), true}), "42 true")
+	assert.Equal(t, consoleFormat([]interface{}{"balance", big.NewInt(42)}), "balance 42")
+	assert.Equal(t, consoleFormat([]interface{}{"balance %d of %s", big.NewInt(42), "alice"}), "balance 42 of alice")
+	assert.Equal(t, consoleFormat([]interface{}{"%d%% %s", big.NewInt(42)}), "42% %s")
+	assert.Equal(t, consoleFormat([]interface{}{"%s", "a", false}), "a false")
+	assert.Equal(t, consoleFormat([]interface{}{"%x", [2]byte{1, 2}}), "%x 0x0102")
+}
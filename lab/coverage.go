@@ -0,0 +1,119 @@
+package lab
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+// codeCoverage counts the executions of the instructions of some code.
+type codeCoverage struct {
+	code []byte
+	hits map[uint64]uint64
+	// the number of times the JUMPI at pc jumped and didn't
+	jumps map[uint64][2]uint64
+}
+
+// coverage accumulates the executed pcs of the lab contracts across txs, until reset.
+type coverage struct {
+	codes map[mapperKey]*codeCoverage
+}
+
+func newCoverage() *coverage {
+	return &coverage{codes: make(map[mapperKey]*codeCoverage)}
+}
+
+// code returns the counts of the code of key, which are reset when the code changes.
+func (c *coverage) code(key mapperKey, code []byte) *codeCoverage {
+	cc := c.codes[key]
+	if cc == nil || !bytes.Equal(cc.code, code) {
+		cc = &codeCoverage{code: common.CopyBytes(code), hits: make(map[uint64]uint64), jumps: make(map[uint64][2]uint64)}
+		c.codes[key] = cc
+	}
+	return cc
+}
+
+// report maps the counts to the solidity files, only the contracts deployed with their artifacts are covered.
+func (c *coverage) report(sources *sourceMaps) (files []*srcmap.FileCoverage) {
+	byName := make(map[string]*srcmap.FileCoverage)
+	for key, cc := range c.codes {
+		if mapper := sources.mapper(key.addr, cc.code, key.create); mapper != nil {
+			mapper.Cover(byName, cc.hits, cc.jumps)
+		}
+	}
+	for _, file := range byName {
+		files = append(files, file)
+	}
+	return
+}
+
+type coverageFrame struct {
+	create bool
+	// resolved at the first step of the frame
+	code *codeCoverage
+}
+
+// coverageTracer counts the executed instructions of a tx into coverage.
+type coverageTracer struct {
+	coverage *coverage
+	frames   []*coverageFrame
+}
+
+func newCoverageTracer(c *coverage) *coverageTracer {
+	return &coverageTracer{coverage: c}
+}
+
+func (t *coverageTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.frames = append(t.frames, &coverageFrame{create: create})
+}
+
+func (t *coverageTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil || len(t.frames) == 0 {
+		return
+	}
+	f := t.frames[len(t.frames)-1]
+	if f.code == nil {
+		f.code = t.coverage.code(mapperKey{addr: codeAddress(scope), create: f.create}, scope.Contract.Code)
+	}
+
+	f.code.hits[pc]++
+	if op == vm.JUMPI && len(scope.Stack.Data()) >= 2 {
+		jumps := f.code.jumps[pc]
+		if scope.Stack.Back(1).IsZero() {
+			jumps[1]++
+		} else {
+			jumps[0]++
+		}
+		f.code.jumps[pc] = jumps
+	}
+}
+
+func (t *coverageTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.frames = append(t.frames, &coverageFrame{create: isCreate(typ)})
+}
+
+func (t *coverageTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if len(t.frames) > 0 {
+		t.frames = t.frames[:len(t.frames)-1]
+	}
+}
+
+func (t *coverageTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *coverageTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	t.frames = nil
+}
+
+// handleCoverage returns the coverage so far, and starts over when input.Reset is set.
+func (e *Engine) handleCoverage(input CoverageInput) (output CoverageOutput) {
+	output.Files = e.coverage.report(e.sources)
+	if input.Reset {
+		e.coverage = newCoverage()
+	}
+	return
+}
@@ -0,0 +1,328 @@
+package lab
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+// a paused session is stopped if no command comes within debugIdleTimeout
+const debugIdleTimeout = 10 * time.Minute
+
+type debugCommand struct {
+	command     string
+	breakpoints []Breakpoint
+}
+
+type debugFrame struct {
+	frame
+	location *srcmap.Location
+}
+
+// debugTracer pauses the execution in CaptureState, which runs in the goroutine of the
+// session, and waits there for the next command.
+type debugTracer struct {
+	sources     *sourceMaps
+	env         *vm.EVM
+	frames      []*debugFrame
+	slots       map[common.Address]map[common.Hash]struct{}
+	breakpoints []Breakpoint
+	command     string
+	// depth at which the command was issued
+	depth   int
+	stopped bool
+	// the line of the previous step, line breakpoints are hit only when entering a line
+	lastLine  string
+	lastDepth int
+
+	paused chan *DebugState
+	resume chan debugCommand
+}
+
+func newDebugTracer(sources *sourceMaps) *debugTracer {
+	return &debugTracer{
+		sources: sources,
+		slots:   make(map[common.Address]map[common.Hash]struct{}),
+		// pause at the first instruction
+		command: DebugStep,
+		paused:  make(chan *DebugState),
+		resume:  make(chan debugCommand),
+	}
+}
+
+func (t *debugTracer) shouldPause(pc uint64, op vm.OpCode, depth int, location *srcmap.Location) bool {
+	var line string
+	if location != nil {
+		line = fmt.Sprintf("%s:%d", location.File, location.Line)
+	}
+	entering := line != "" && (line != t.lastLine || depth != t.lastDepth)
+	t.lastLine, t.lastDepth = line, depth
+
+	for _, bp := range t.breakpoints {
+		switch {
+		case bp.PC != nil:
+			if *bp.PC == pc {
+				return true
+			}
+		case bp.Op != "":
+			if vm.StringToOp(strings.ToUpper(bp.Op)) == op {
+				return true
+			}
+		case bp.Line != 0:
+			if entering && location.Line == bp.Line && sameFile(location.File, bp.File) {
+				return true
+			}
+		}
+	}
+
+	switch t.command {
+	case DebugStep:
+		return true
+	case DebugNext:
+		return depth <= t.depth
+	case DebugOut:
+		return depth < t.depth
+	default:
+		return false
+	}
+}
+
+// sameFile matches a file of the source list against the file of a breakpoint,
+// which can be just the base name.
+func sameFile(file, bpFile string) bool {
+	return bpFile == "" || file == bpFile || filepath.Base(file) == bpFile
+}
+
+func (t *debugTracer) state(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, location *srcmap.Location) *DebugState {
+	state := &DebugState{
+		PC:       pc,
+		Op:       op.String(),
+		Gas:      gas,
+		Cost:     cost,
+		Depth:    depth,
+		Memory:   common.CopyBytes(scope.Memory.Data()),
+		Storage:  make(map[common.Hash]common.Hash),
+		Location: location,
+	}
+	stack := scope.Stack.Data()
+	for i := range stack {
+		state.Stack = append(state.Stack, stack[i].Hex())
+	}
+	addr := scope.Contract.Address()
+	for slot := range t.slots[addr] {
+		state.Storage[slot] = t.env.StateDB.GetState(addr, slot)
+	}
+	for _, f := range t.frames {
+		state.CallStack = append(state.CallStack, DebugFrame{
+			Type:     f.typ.String(),
+			From:     f.from,
+			To:       f.to,
+			Contract: t.sources.name(f.to),
+			Location: f.location,
+		})
+	}
+	return state
+}
+
+func (t *debugTracer) stop() {
+	t.stopped = true
+	if t.env != nil {
+		t.env.Cancel()
+	}
+}
+
+func (t *debugTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	t.frames = append(t.frames, &debugFrame{frame: frame{typ: typ, from: from, to: to, create: create}})
+}
+
+func (t *debugTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if t.stopped || len(t.frames) == 0 {
+		return
+	}
+	f := t.frames[len(t.frames)-1]
+
+	addr := scope.Contract.Address()
+	if (op == vm.SLOAD || op == vm.SSTORE) && len(scope.Stack.Data()) > 0 {
+		if t.slots[addr] == nil {
+			t.slots[addr] = make(map[common.Hash]struct{})
+		}
+		t.slots[addr][common.Hash(scope.Stack.Back(0).Bytes32())] = struct{}{}
+	}
+
+	location := t.sources.location(codeAddress(scope), scope.Contract.Code, f.create, pc)
+	f.location = location
+	if !t.shouldPause(pc, op, depth, location) {
+		return
+	}
+
+	t.paused <- t.state(pc, op, gas, cost, scope, depth, location)
+	select {
+	case cmd := <-t.resume:
+		if cmd.breakpoints != nil {
+			t.breakpoints = cmd.breakpoints
+		}
+		t.command = cmd.command
+		t.depth = depth
+		if cmd.command == DebugStop {
+			t.stop()
+		}
+	case <-time.After(debugIdleTimeout):
+		t.stop()
+	}
+}
+
+func (t *debugTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.frames = append(t.frames, &debugFrame{frame: frame{typ: typ, from: from, to: to, create: isCreate(typ)}})
+}
+
+func (t *debugTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if len(t.frames) > 0 {
+		t.frames = t.frames[:len(t.frames)-1]
+	}
+}
+
+func (t *debugTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *debugTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+}
+
+// debugSession is a deploy or call running in its own goroutine on a copy of the state,
+// paused by its tracer in between the commands.
+type debugSession struct {
+	sync.Mutex
+	id     string
+	tracer *debugTracer
+	done   chan DebugOutput
+}
+
+// wait blocks until the execution pauses or ends.
+func (session *debugSession) wait() (output DebugOutput) {
+	select {
+	case state := <-session.tracer.paused:
+		output.State = state
+	case output = <-session.done:
+	}
+	output.Session = session.id
+	return
+}
+
+func (session *debugSession) command(cmd debugCommand) DebugOutput {
+	session.Lock()
+	defer session.Unlock()
+
+	select {
+	case session.tracer.resume <- cmd:
+	case output := <-session.done:
+		// stopped by the idle timeout
+		output.Session = session.id
+		return output
+	}
+	return session.wait()
+}
+
+// debugSessions holds the sessions by id, they are removed once their execution returns.
+type debugSessions struct {
+	sync.Mutex
+	nextID   uint64
+	sessions map[string]*debugSession
+}
+
+func newDebugSessions() *debugSessions {
+	return &debugSessions{sessions: make(map[string]*debugSession)}
+}
+
+func (ds *debugSessions) add(session *debugSession) {
+	session.id = fmt.Sprint(atomic.AddUint64(&ds.nextID, 1))
+	ds.Lock()
+	ds.sessions[session.id] = session
+	ds.Unlock()
+}
+
+func (ds *debugSessions) get(id string) *debugSession {
+	ds.Lock()
+	defer ds.Unlock()
+	return ds.sessions[id]
+}
+
+func (ds *debugSessions) remove(id string) {
+	ds.Lock()
+	delete(ds.sessions, id)
+	ds.Unlock()
+}
+
+// handleDebugStart starts the deploy or call of input paused at its first instruction.
+// It runs on a copy of the state, block and source maps, so the lab ones are left untouched.
+func (e *Engine) handleDebugStart(input DebugStartInput) (output DebugOutput) {
+	statedb, sources := e.statedb.Copy(), e.sources.copy()
+	tracer := newDebugTracer(sources)
+	execFunc, err := e.prepareTx(e.block(), statedb, sources, input.Deploy, input.Call, tracer)
+	if err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+
+	session := &debugSession{tracer: tracer, done: make(chan DebugOutput, 1)}
+	e.debugSessions.add(session)
+	go func() {
+		r := execFunc()
+		session.done <- DebugOutput{Done: true, Result: r.result, Addr: r.addr, GasUsed: r.gasUsed, ErrMsg: r.errMsg}
+		// also when stopped by the idle timeout, so that abandoned sessions don't pile up
+		e.debugSessions.remove(session.id)
+	}()
+
+	return session.wait()
+}
+
+// handleDebugCommand resumes a paused session with input.Command, and waits until it pauses again.
+func (e *Engine) handleDebugCommand(input DebugCommandInput) (output DebugOutput) {
+	session := e.debugSessions.get(input.Session)
+	if session == nil {
+		output.ErrMsg = fmt.Sprintf("debug session %q not found, it may have ended or been idle for too long", input.Session)
+		return
+	}
+
+	if err := checkDebugCommand(input); err != nil {
+		output.Session = input.Session
+		output.ErrMsg = err.Error()
+		return
+	}
+
+	return session.command(debugCommand{command: input.Command, breakpoints: input.Breakpoints})
+}
+
+func checkDebugCommand(input DebugCommandInput) error {
+	switch input.Command {
+	case DebugStep, DebugNext, DebugOut, DebugContinue, DebugStop:
+	default:
+		return fmt.Errorf("unknown debug command %q", input.Command)
+	}
+
+	for _, bp := range input.Breakpoints {
+		switch {
+		case bp.PC != nil:
+		case bp.Op != "":
+			if _, err := ParseOp(bp.Op); err != nil {
+				return err
+			}
+		case bp.Line != 0:
+		default:
+			return errors.New("empty breakpoint")
+		}
+	}
+	return nil
+}
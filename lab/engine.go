@@ -0,0 +1,238 @@
+// Package lab is the lab EVM and its state, embeddable without any transport: the server
+// exposes an Engine over HTTP, and Go tests can run one in process.
+package lab
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/zhiqiangxu/evm-lab/config"
+	"github.com/zhiqiangxu/evm-lab/wallet"
+)
+
+// Engine executes deploys and calls against its own state. Its methods are safe for concurrent
+// use, the txs being executed one at a time, and engines don't share anything, so that tests
+// can run one each in parallel.
+type Engine struct {
+	mu      sync.Mutex
+	conf    config.Config
+	statedb *state.StateDB
+	sources *sourceMaps
+	// BLOCKHASH of the chain the state is forked from, if any
+	getHash func(uint64) common.Hash
+	// number of lab txs, which tells their logs apart
+	txCount uint64
+
+	debugSessions *debugSessions
+	snapshots     *snapshots
+	coverage      *coverage
+}
+
+// NewEngine returns an engine at the genesis state of conf.
+func NewEngine(conf config.Config) (*Engine, error) {
+	e := &Engine{
+		conf:          conf,
+		sources:       newSourceMaps(),
+		debugSessions: newDebugSessions(),
+		snapshots:     newSnapshots(),
+		coverage:      newCoverage(),
+	}
+	if err := e.initState(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Fork returns an independent engine with the state saved by the snapshot id, the current
+// state if id is 0, and the source maps of the contracts deployed so far.
+func (e *Engine) Fork(id uint64) (*Engine, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statedb := e.statedb
+	if id != 0 {
+		var ok bool
+		if statedb, ok = e.snapshots.states[id]; !ok {
+			return nil, fmt.Errorf("snapshot %d not found", id)
+		}
+	}
+	return &Engine{
+		conf:          e.conf,
+		statedb:       statedb.Copy(),
+		sources:       e.sources.copy(),
+		getHash:       e.getHash,
+		txCount:       e.txCount,
+		debugSessions: newDebugSessions(),
+		snapshots:     newSnapshots(),
+		coverage:      newCoverage(),
+	}, nil
+}
+
+func (e *Engine) initState() (err error) {
+	if e.conf.Genesis == nil {
+		e.conf.Genesis = &core.Genesis{}
+	}
+
+	if e.conf.Fork != nil {
+		if err = e.initForkState(); err != nil {
+			return
+		}
+	} else {
+		e.statedb, _ = state.New(common.Hash{}, newStateDatabase(rawdb.NewMemoryDatabase()), nil)
+	}
+	if e.conf.DevAccounts != nil {
+		var alloc core.GenesisAlloc
+		if alloc, err = wallet.DevAlloc(e.conf.DevAccounts); err != nil {
+			return
+		}
+		setAlloc(e.statedb, alloc)
+	}
+	setAlloc(e.statedb, e.conf.Genesis.Alloc)
+
+	if e.conf.Cheatcodes {
+		e.statedb.SetCode(HEVMAddress, hevmCode)
+		e.statedb.Commit(true)
+	}
+
+	return
+}
+
+// Deploy ...
+func (e *Engine) Deploy(input DeployInput) DeployOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleDeploy(input)
+}
+
+// Call ...
+func (e *Engine) Call(input CallInput) CallOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleCall(input)
+}
+
+// StaticCall runs the call without keeping its changes.
+func (e *Engine) StaticCall(input CallInput) CallOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleStaticCall(input)
+}
+
+// ChainInfo returns the chain ID and the lab block, for the txs to be signed.
+func (e *Engine) ChainInfo() ChainInfoOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleChainInfo()
+}
+
+// SendRawTransaction executes a signed tx with the checks of a node.
+func (e *Engine) SendRawTransaction(input SendRawTransactionInput) SendRawTransactionOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleSendRawTransaction(input)
+}
+
+// CreateAccessList ...
+func (e *Engine) CreateAccessList(input CallInput) AccessListOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleCreateAccessList(input)
+}
+
+// EstimateGas ...
+func (e *Engine) EstimateGas(input EstimateGasInput) EstimateGasOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleEstimateGas(input)
+}
+
+// DebugStart starts a debug session of the deploy or call of input, on a copy of the state.
+func (e *Engine) DebugStart(input DebugStartInput) DebugOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleDebugStart(input)
+}
+
+// DebugCommand resumes a debug session. It doesn't wait for the txs, since the session
+// runs on its own copy of the state.
+func (e *Engine) DebugCommand(input DebugCommandInput) DebugOutput {
+	return e.handleDebugCommand(input)
+}
+
+// Trace runs the deploy or call of input on a copy of the state, streaming the events through
+// emit. Only the copies are made under the lock, so the trace can be as slow as emit.
+func (e *Engine) Trace(input TraceInput, emit func(TraceEvent) error) error {
+	e.mu.Lock()
+	block, statedb, sources := e.block(), e.statedb.Copy(), e.sources.copy()
+	e.mu.Unlock()
+
+	return e.handleTrace(block, statedb, sources, input, emit)
+}
+
+// SetState overwrites the fields of an account which are set in input.
+func (e *Engine) SetState(input SetStateInput) SetStateOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleSetState(input)
+}
+
+// GetState returns the account of input.
+func (e *Engine) GetState(input GetStateInput) GetStateOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleGetState(input)
+}
+
+// ExportState returns the genesis with the current state as its alloc, to be saved in a config.
+func (e *Engine) ExportState() ExportStateOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleExportState()
+}
+
+// ImportState replaces the state with the alloc of input.Genesis.
+func (e *Engine) ImportState(input ImportStateInput) ImportStateOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleImportState(input)
+}
+
+// Snapshot saves the current state, and returns the id to Revert to.
+func (e *Engine) Snapshot() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.snapshot()
+}
+
+// Revert restores the state saved by Snapshot, the snapshot is kept.
+func (e *Engine) Revert(id uint64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.revert(id)
+}
+
+// Coverage returns the coverage so far, when Coverage is set in the config.
+func (e *Engine) Coverage(input CoverageInput) CoverageOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.handleCoverage(input)
+}
@@ -0,0 +1,147 @@
+package lab
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zhiqiangxu/evm-lab/config"
+	"gotest.tools/assert"
+)
+
+var (
+	// the runtime code increments slot 0, emits the new count as the data of a LOG0, and returns it
+	counterRuntime = common.FromHex("6000546001018060005560005260206000a060206000f3")
+	// the creation code emits an empty LOG0, and returns the runtime code
+	counterCreation = append(common.FromHex("60176010600039600080a060176000f3"), counterRuntime...)
+
+	testSenderKey, _ = crypto.HexToECDSA("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80")
+	testSenderAddr   = crypto.PubkeyToAddress(testSenderKey.PublicKey)
+)
+
+func newTestEngine(t *testing.T) *Engine {
+	engine, err := NewEngine(config.Config{
+		Quiet: true,
+		Genesis: &core.Genesis{
+			GasLimit: 10000000,
+			Alloc: core.GenesisAlloc{
+				testSenderAddr: {Balance: new(big.Int).Mul(big.NewInt(1e9), big.NewInt(1e18))},
+			},
+		},
+	})
+	assert.NilError(t, err)
+	return engine
+}
+
+func deployCounter(t *testing.T, engine *Engine) common.Address {
+	output := engine.Deploy(DeployInput{Sender: testSenderAddr, CodeAndInput: counterCreation})
+	assert.Equal(t, output.ErrMsg, "")
+	assert.Equal(t, output.Addr, crypto.CreateAddress(testSenderAddr, 0))
+	return output.Addr
+}
+
+func callCounter(t *testing.T, engine *Engine, addr common.Address) uint64 {
+	output := engine.Call(CallInput{Sender: testSenderAddr, Receiver: addr})
+	assert.Equal(t, output.ErrMsg, "")
+	return new(big.Int).SetBytes(output.Result).Uint64()
+}
+
+func TestEngine(t *testing.T) {
+	engine := newTestEngine(t)
+	addr := deployCounter(t, engine)
+	assert.Equal(t, engine.GetState(GetStateInput{Address: addr}).State.Code.String(), hexutil.Encode(counterRuntime))
+
+	assert.Equal(t, callCounter(t, engine, addr), uint64(1))
+	assert.Equal(t, callCounter(t, engine, addr), uint64(2))
+
+	// a static call sees the state, without changing it
+	static := engine.StaticCall(CallInput{Sender: testSenderAddr, Receiver: addr})
+	assert.Equal(t, static.ErrMsg, "")
+	assert.Equal(t, new(big.Int).SetBytes(static.Result).Uint64(), uint64(3))
+
+	snapshot := engine.Snapshot()
+	assert.Equal(t, callCounter(t, engine, addr), uint64(3))
+	assert.Equal(t, callCounter(t, engine, addr), uint64(4))
+
+	// the snapshot is kept, so it can be reverted to again
+	for i := 0; i < 2; i++ {
+		assert.NilError(t, engine.Revert(snapshot))
+		slot := engine.GetState(GetStateInput{Address: addr, Storage: []common.Hash{{}}}).State.Storage[common.Hash{}]
+		assert.Equal(t, slot, common.BigToHash(big.NewInt(2)))
+		assert.Equal(t, callCounter(t, engine, addr), uint64(3))
+	}
+	assert.Assert(t, engine.Revert(snapshot+1) != nil)
+
+	// engines don't share anything
+	other := newTestEngine(t)
+	assert.Equal(t, len(other.GetState(GetStateInput{Address: addr}).State.Code), 0)
+}
+
+func TestEngineEstimateGas(t *testing.T) {
+	engine := newTestEngine(t)
+	addr := deployCounter(t, engine)
+
+	call := CallInput{Sender: testSenderAddr, Receiver: addr}
+	output := engine.EstimateGas(EstimateGasInput{Call: &call})
+	assert.Equal(t, output.ErrMsg, "")
+	assert.Assert(t, output.Gas > output.IntrinsicGas)
+	assert.Assert(t, output.Gas >= output.GasUsed)
+
+	// enough gas for the estimate to succeed, and one less fails
+	call.Gas = output.Gas
+	assert.Equal(t, engine.StaticCall(call).ErrMsg, "")
+	call.Gas = output.Gas - 1
+	assert.Assert(t, engine.StaticCall(call).ErrMsg != "")
+
+	// the gas of the input caps the estimate
+	call.Gas = output.IntrinsicGas
+	assert.Assert(t, engine.EstimateGas(EstimateGasInput{Call: &call}).ErrMsg != "")
+}
+
+// assertCounterLog checks that logs is the single LOG0 emitted by the counter.
+func assertCounterLog(t *testing.T, logs []Log, addr common.Address, data []byte) {
+	t.Helper()
+	assert.Equal(t, len(logs), 1)
+	assert.Equal(t, logs[0].Address, addr)
+	assert.Equal(t, len(logs[0].Topics), 0)
+	assert.Equal(t, logs[0].Data.String(), hexutil.Encode(data))
+}
+
+func TestEngineLogs(t *testing.T) {
+	engine := newTestEngine(t)
+
+	deploy := engine.Deploy(DeployInput{Sender: testSenderAddr, CodeAndInput: counterCreation})
+	assert.Equal(t, deploy.ErrMsg, "")
+	assertCounterLog(t, deploy.Logs, deploy.Addr, nil)
+
+	chain := engine.ChainInfo()
+	tx, err := types.SignNewTx(testSenderKey, types.LatestSignerForChainID(chain.ChainID), &types.DynamicFeeTx{
+		ChainID:   chain.ChainID,
+		Nonce:     *engine.GetState(GetStateInput{Address: testSenderAddr}).State.Nonce,
+		GasTipCap: new(big.Int),
+		GasFeeCap: chain.BaseFee,
+		Gas:       100000,
+		To:        &deploy.Addr,
+	})
+	assert.NilError(t, err)
+	txBytes, err := tx.MarshalBinary()
+	assert.NilError(t, err)
+	raw := engine.SendRawTransaction(SendRawTransactionInput{Tx: txBytes})
+	assert.Equal(t, raw.ErrMsg, "")
+	assertCounterLog(t, raw.Logs, deploy.Addr, common.BigToHash(big.NewInt(1)).Bytes())
+
+	call := engine.Call(CallInput{Sender: testSenderAddr, Receiver: deploy.Addr})
+	assert.Equal(t, call.ErrMsg, "")
+	assertCounterLog(t, call.Logs, deploy.Addr, common.BigToHash(big.NewInt(2)).Bytes())
+
+	// a reverted state drops the logs after the snapshot, without mixing them up with the next ones
+	snapshot := engine.Snapshot()
+	assert.Equal(t, callCounter(t, engine, deploy.Addr), uint64(3))
+	assert.NilError(t, engine.Revert(snapshot))
+	call = engine.Call(CallInput{Sender: testSenderAddr, Receiver: deploy.Addr})
+	assertCounterLog(t, call.Logs, deploy.Addr, common.BigToHash(big.NewInt(3)).Bytes())
+}
@@ -0,0 +1,96 @@
+package lab
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+)
+
+// handleEstimateGas binary searches the minimum gas limit that makes the deploy or call succeed.
+// Every attempt runs on a copy of the state, so the 63/64 rule and refunds are accounted for
+// simply by observing whether the execution succeeds.
+func (e *Engine) handleEstimateGas(input EstimateGasInput) (output EstimateGasOutput) {
+	if (input.Deploy == nil) == (input.Call == nil) {
+		output.ErrMsg = "exactly one of Deploy and Call should be specified"
+		return
+	}
+
+	// the gas of the input caps the search like the block gas limit, as with eth_estimateGas
+	hi := e.block().blockGasLimit()
+	if gas := input.gas(); gas != 0 && (hi == 0 || gas < hi) {
+		hi = gas
+	}
+
+	// execute with the cap first, if it fails there is nothing to search for
+	used, _, intrinsicGas, err := e.tryGas(input, hi)
+	if err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+	output.IntrinsicGas = intrinsicGas
+
+	// the gas used with the cap is a lower bound
+	lo := used - 1
+	for lo+1 < hi {
+		mid := (hi + lo) / 2
+		if _, _, _, err := e.tryGas(input, mid); err != nil {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	used, refund, _, err := e.tryGas(input, hi)
+	if err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+
+	output.Gas = hi
+	output.Refund = refund
+	output.GasUsed = used - refund
+	return
+}
+
+// tryGas executes the input with gas on a copy of the state, and returns the gas used
+// before refund together with the capped refund.
+func (e *Engine) tryGas(input EstimateGasInput, gas uint64) (used, refund, intrinsicGas uint64, err error) {
+	block := e.block()
+	statedb := e.statedb.Copy()
+
+	var (
+		execGas       uint64
+		runtimeConfig *runtime.Config
+		outputBytes   []byte
+		leftOverGas   uint64
+	)
+	if input.Deploy != nil {
+		execGas, intrinsicGas, err = block.buyGas(gas, input.Deploy.CodeAndInput, input.Deploy.AccessList, true)
+		if err != nil {
+			return
+		}
+		runtimeConfig, err = block.newRuntimeConfig(statedb, input.Deploy.Sender, execGas, input.Deploy.Value, input.Deploy.GasPrice, input.Deploy.MaxFeePerGas, input.Deploy.MaxPriorityFeePerGas, input.Deploy.AccessList, nil)
+		if err != nil {
+			return
+		}
+		outputBytes, _, leftOverGas, err = applyCreate(runtimeConfig, input.Deploy.CodeAndInput, input.Deploy.AccessList)
+	} else {
+		execGas, intrinsicGas, err = block.buyGas(gas, input.Call.Input, input.Call.AccessList, false)
+		if err != nil {
+			return
+		}
+		runtimeConfig, err = block.newRuntimeConfig(statedb, input.Call.Sender, execGas, input.Call.Value, input.Call.GasPrice, input.Call.MaxFeePerGas, input.Call.MaxPriorityFeePerGas, input.Call.AccessList, nil)
+		if err != nil {
+			return
+		}
+		outputBytes, leftOverGas, err = applyCall(runtimeConfig, input.Call.Receiver, input.Call.Input, input.Call.AccessList)
+	}
+	if err != nil {
+		err = errors.New(parseRevertReason(err, outputBytes))
+		return
+	}
+
+	used = intrinsicGas + execGas - leftOverGas
+	refund = block.refund(statedb, used)
+	return
+}
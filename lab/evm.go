@@ -0,0 +1,282 @@
+package lab
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// blockEnv is the lab block the txs run in. The txs which run after the engine lock is released,
+// like the traced and debugged ones, get their own copy, since the state import replaces it.
+type blockEnv struct {
+	genesis *core.Genesis
+	// BLOCKHASH of the chain the state is forked from, if any
+	getHash func(uint64) common.Hash
+}
+
+func (e *Engine) block() blockEnv {
+	return blockEnv{genesis: e.conf.Genesis, getHash: e.getHash}
+}
+
+// chainConfig has all the forks enabled by default.
+func (b blockEnv) chainConfig() *params.ChainConfig {
+	if b.genesis.Config != nil {
+		return b.genesis.Config
+	}
+	return params.AllEthashProtocolChanges
+}
+
+func (b blockEnv) rules() params.Rules {
+	return b.chainConfig().Rules(new(big.Int).SetUint64(b.genesis.Number), false)
+}
+
+// baseFee returns the base fee of the lab block, nil before london.
+func (b blockEnv) baseFee() *big.Int {
+	if !b.chainConfig().IsLondon(new(big.Int).SetUint64(b.genesis.Number)) {
+		return nil
+	}
+	if b.genesis.BaseFee != nil {
+		return b.genesis.BaseFee
+	}
+	return big.NewInt(params.InitialBaseFee)
+}
+
+// blockGasLimit is the gas limit of the lab block, 0 means unlimited.
+func (b blockEnv) blockGasLimit() uint64 {
+	return b.genesis.GasLimit
+}
+
+// buyGas checks the gas limit of a tx against the block gas limit, and returns the gas
+// left for execution once the intrinsic gas is paid.
+func (b blockEnv) buyGas(gas uint64, data []byte, accessList types.AccessList, create bool) (execGas, intrinsicGas uint64, err error) {
+	limit := b.blockGasLimit()
+	if gas == 0 {
+		if limit == 0 {
+			err = errors.New("gas limit not specified and block gas limit is unlimited")
+			return
+		}
+		gas = limit
+	}
+	if limit != 0 && gas > limit {
+		err = fmt.Errorf("%w: tx gas %d exceeds block gas limit %d", core.ErrGasLimitReached, gas, limit)
+		return
+	}
+
+	rules := b.rules()
+	intrinsicGas, err = core.IntrinsicGas(data, accessList, create, rules.IsHomestead, rules.IsIstanbul)
+	if err != nil {
+		return
+	}
+	if gas < intrinsicGas {
+		err = fmt.Errorf("%w: have %d, want %d", core.ErrIntrinsicGas, gas, intrinsicGas)
+		return
+	}
+	execGas = gas - intrinsicGas
+	return
+}
+
+// refund returns the refund counter of statedb, capped by the gas used of the tx.
+func (b blockEnv) refund(statedb *state.StateDB, gasUsed uint64) uint64 {
+	quotient := params.RefundQuotient
+	if b.rules().IsLondon {
+		quotient = params.RefundQuotientEIP3529
+	}
+	refund := statedb.GetRefund()
+	if max := gasUsed / quotient; refund > max {
+		refund = max
+	}
+	return refund
+}
+
+// effectiveGasPrice resolves the GASPRICE seen by the tx, following the EIP-1559 rules
+// when either of the fee cap fields is specified.
+func (b blockEnv) effectiveGasPrice(gasPrice, maxFee, maxTip *big.Int) (*big.Int, error) {
+	if maxFee == nil && maxTip == nil {
+		if gasPrice == nil {
+			return new(big.Int), nil
+		}
+		return gasPrice, nil
+	}
+	if gasPrice != nil && gasPrice.Sign() != 0 {
+		return nil, errors.New("both gasPrice and (maxFeePerGas or maxPriorityFeePerGas) specified")
+	}
+
+	baseFee := b.baseFee()
+	if baseFee == nil {
+		return nil, fmt.Errorf("%w: maxFeePerGas/maxPriorityFeePerGas need london", core.ErrTxTypeNotSupported)
+	}
+	if maxTip == nil {
+		maxTip = new(big.Int)
+	}
+	if maxFee == nil {
+		maxFee = new(big.Int).Add(baseFee, maxTip)
+	}
+	if maxFee.Cmp(maxTip) < 0 {
+		return nil, fmt.Errorf("%w: maxPriorityFeePerGas: %s, maxFeePerGas: %s", core.ErrTipAboveFeeCap, maxTip, maxFee)
+	}
+	if maxFee.Cmp(baseFee) < 0 {
+		return nil, fmt.Errorf("%w: maxFeePerGas: %s baseFee: %s", core.ErrFeeCapTooLow, maxFee, baseFee)
+	}
+
+	price := new(big.Int).Add(baseFee, maxTip)
+	if price.Cmp(maxFee) > 0 {
+		price.Set(maxFee)
+	}
+	return price, nil
+}
+
+// blockHash is the BLOCKHASH of block n, made up unless the lab is forked from a chaindata.
+func (b blockEnv) blockHash(n uint64) common.Hash {
+	if b.getHash != nil {
+		return b.getHash(n)
+	}
+	return common.BytesToHash(crypto.Keccak256([]byte(new(big.Int).SetUint64(n).String())))
+}
+
+func (b blockEnv) newRuntimeConfig(statedb *state.StateDB, sender common.Address, gas uint64, value, gasPrice, maxFee, maxTip *big.Int, accessList types.AccessList, tracer vm.EVMLogger) (*runtime.Config, error) {
+	price, err := b.effectiveGasPrice(gasPrice, maxFee, maxTip)
+	if err != nil {
+		return nil, err
+	}
+
+	number := new(big.Int).SetUint64(b.genesis.Number)
+	if len(accessList) > 0 && !b.chainConfig().IsBerlin(number) {
+		return nil, fmt.Errorf("%w: access list needs berlin", core.ErrTxTypeNotSupported)
+	}
+
+	if value == nil {
+		value = new(big.Int)
+	}
+	// runtime.NewEnv doesn't default it, and DIFFICULTY can't handle nil
+	difficulty := b.genesis.Difficulty
+	if difficulty == nil {
+		difficulty = new(big.Int)
+	}
+
+	return &runtime.Config{
+		ChainConfig: b.chainConfig(),
+		Origin:      sender,
+		State:       statedb,
+		GasLimit:    gas,
+		GasPrice:    price,
+		Value:       value,
+		Difficulty:  difficulty,
+		Time:        new(big.Int).SetUint64(b.genesis.Timestamp),
+		Coinbase:    b.genesis.Coinbase,
+		BlockNumber: number,
+		BaseFee:     b.baseFee(),
+		GetHashFn:   b.blockHash,
+		EVMConfig: vm.Config{
+			Tracer: tracer,
+			Debug:  tracer != nil,
+		},
+	}, nil
+}
+
+// applyCreate is runtime.Create, except that the access list of the tx is prepared as well.
+func applyCreate(cfg *runtime.Config, input []byte, accessList types.AccessList) ([]byte, common.Address, uint64, error) {
+	vmenv := runtime.NewEnv(cfg)
+	sender := vm.AccountRef(cfg.Origin)
+	if rules := cfg.ChainConfig.Rules(vmenv.Context.BlockNumber, vmenv.Context.Random != nil); rules.IsBerlin {
+		cfg.State.PrepareAccessList(cfg.Origin, nil, vm.ActivePrecompiles(rules), accessList)
+	}
+
+	return vmenv.Create(sender, input, cfg.GasLimit, cfg.Value)
+}
+
+// applyCall is runtime.Call, except that the access list of the tx is prepared as well.
+func applyCall(cfg *runtime.Config, address common.Address, input []byte, accessList types.AccessList) ([]byte, uint64, error) {
+	vmenv := runtime.NewEnv(cfg)
+	sender := cfg.State.GetOrNewStateObject(cfg.Origin)
+	if rules := cfg.ChainConfig.Rules(vmenv.Context.BlockNumber, vmenv.Context.Random != nil); rules.IsBerlin {
+		cfg.State.PrepareAccessList(cfg.Origin, &address, vm.ActivePrecompiles(rules), accessList)
+	}
+
+	return vmenv.Call(sender, address, input, cfg.GasLimit, cfg.Value)
+}
+
+// txLogs returns the logs emitted by the tx prepared with hash.
+func txLogs(statedb *state.StateDB, hash common.Hash) (logs []Log) {
+	for _, l := range statedb.GetLogs(hash, common.Hash{}) {
+		logs = append(logs, Log{Address: l.Address, Topics: l.Topics, Data: l.Data})
+	}
+	return
+}
+
+// nextTxHash returns a new hash to tell the logs of a lab tx apart, the lab txs not being signed.
+func (e *Engine) nextTxHash() common.Hash {
+	e.txCount++
+	return crypto.Keccak256Hash([]byte("evm-lab tx"), new(big.Int).SetUint64(e.txCount).Bytes())
+}
+
+// txResult is the result of a deploy or call prepared by prepareTx.
+type txResult struct {
+	result  []byte
+	addr    common.Address
+	gasUsed uint64
+	// with the revert reason parsed
+	errMsg string
+}
+
+// prepareTx buys the gas of either the deploy or the call, and returns a function
+// that executes it on statedb in block, for the tools that don't commit, like the debugger.
+// The artifact of a deploy is registered in sources, the copy the tracer reads.
+func (e *Engine) prepareTx(block blockEnv, statedb *state.StateDB, sources *sourceMaps, deploy *DeployInput, call *CallInput, tracer vm.EVMLogger) (func() txResult, error) {
+	if (deploy == nil) == (call == nil) {
+		return nil, errors.New("exactly one of Deploy and Call should be specified")
+	}
+
+	if deploy != nil {
+		execGas, intrinsicGas, err := block.buyGas(deploy.Gas, deploy.CodeAndInput, deploy.AccessList, true)
+		if err != nil {
+			return nil, err
+		}
+		runtimeConfig, err := block.newRuntimeConfig(statedb, deploy.Sender, execGas, deploy.Value, deploy.GasPrice, deploy.MaxFeePerGas, deploy.MaxPriorityFeePerGas, deploy.AccessList, tracer)
+		if err != nil {
+			return nil, err
+		}
+		sources.register(crypto.CreateAddress(deploy.Sender, statedb.GetNonce(deploy.Sender)), deploy.Artifact)
+
+		return func() (r txResult) {
+			outputBytes, addr, leftOverGas, err := applyCreate(runtimeConfig, deploy.CodeAndInput, deploy.AccessList)
+			r.addr = addr
+			r.gasUsed = intrinsicGas + execGas - leftOverGas
+			if err != nil {
+				r.errMsg = parseRevertReason(err, outputBytes)
+				return
+			}
+			r.gasUsed -= block.refund(statedb, r.gasUsed)
+			return
+		}, nil
+	}
+
+	execGas, intrinsicGas, err := block.buyGas(call.Gas, call.Input, call.AccessList, false)
+	if err != nil {
+		return nil, err
+	}
+	runtimeConfig, err := block.newRuntimeConfig(statedb, call.Sender, execGas, call.Value, call.GasPrice, call.MaxFeePerGas, call.MaxPriorityFeePerGas, call.AccessList, tracer)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (r txResult) {
+		outputBytes, leftOverGas, err := applyCall(runtimeConfig, call.Receiver, call.Input, call.AccessList)
+		r.result = outputBytes
+		r.gasUsed = intrinsicGas + execGas - leftOverGas
+		if err != nil {
+			r.errMsg = parseRevertReason(err, outputBytes)
+			return
+		}
+		r.gasUsed -= block.refund(statedb, r.gasUsed)
+		return
+	}, nil
+}
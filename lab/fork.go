@@ -0,0 +1,238 @@
+package lab
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/zhiqiangxu/evm-lab/config"
+)
+
+// chaindatas are opened once per process and shared by the engines, since leveldb locks its directory.
+var chaindatas = struct {
+	sync.Mutex
+	dbs map[string]ethdb.Database
+}{dbs: make(map[string]ethdb.Database)}
+
+func openChaindata(dir string) (ethdb.Database, error) {
+	chaindatas.Lock()
+	defer chaindatas.Unlock()
+
+	dir = filepath.Clean(dir)
+	if db := chaindatas.dbs[dir]; db != nil {
+		return db, nil
+	}
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(dir, 256, 16, filepath.Join(dir, "ancient"), "", true)
+	if err != nil {
+		return nil, fmt.Errorf("open chaindata %s err:%v", dir, err)
+	}
+	chaindatas.dbs[dir] = db
+	return db, nil
+}
+
+// overlayDB reads through to a read only database, and keeps the writes in memory.
+type overlayDB struct {
+	ethdb.Database
+	mem *memorydb.Database
+}
+
+func newOverlayDB(disk ethdb.Database) *overlayDB {
+	return &overlayDB{Database: disk, mem: memorydb.New()}
+}
+
+func (db *overlayDB) Has(key []byte) (bool, error) {
+	if ok, _ := db.mem.Has(key); ok {
+		return true, nil
+	}
+	return db.Database.Has(key)
+}
+
+func (db *overlayDB) Get(key []byte) ([]byte, error) {
+	if value, err := db.mem.Get(key); err == nil {
+		return value, nil
+	}
+	return db.Database.Get(key)
+}
+
+func (db *overlayDB) Put(key []byte, value []byte) error {
+	return db.mem.Put(key, value)
+}
+
+func (db *overlayDB) Delete(key []byte) error {
+	return db.mem.Delete(key)
+}
+
+func (db *overlayDB) NewBatch() ethdb.Batch {
+	return db.mem.NewBatch()
+}
+
+// initForkState seeds the state from e.conf.Fork, the genesis alloc is set over it afterwards.
+func (e *Engine) initForkState() (err error) {
+	fork := e.conf.Fork
+	switch {
+	case (fork.Chaindata == "") == (fork.Dump == ""):
+		return fmt.Errorf("exactly one of Chaindata and Dump of Fork should be set")
+	case fork.Chaindata != "":
+		err = e.forkChaindata(fork)
+	default:
+		if fork.Block != nil {
+			return fmt.Errorf("Block of Fork is for Chaindata, set Genesis.Number for a dump")
+		}
+		e.statedb, _ = state.New(common.Hash{}, newStateDatabase(rawdb.NewMemoryDatabase()), nil)
+		err = loadDump(e.statedb, fork.Dump)
+	}
+	return
+}
+
+// forkChaindata opens the state of a block of the chaindata, and makes the lab block its child.
+func (e *Engine) forkChaindata(fork *config.Fork) (err error) {
+	disk, err := openChaindata(fork.Chaindata)
+	if err != nil {
+		return
+	}
+
+	var number uint64
+	if fork.Block != nil {
+		number = *fork.Block
+	} else {
+		head := rawdb.ReadHeaderNumber(disk, rawdb.ReadHeadHeaderHash(disk))
+		if head == nil {
+			return fmt.Errorf("head block not found in %s", fork.Chaindata)
+		}
+		number = *head
+	}
+	hash := rawdb.ReadCanonicalHash(disk, number)
+	header := rawdb.ReadHeader(disk, hash, number)
+	if header == nil {
+		return fmt.Errorf("block %d not found in %s", number, fork.Chaindata)
+	}
+
+	// the genesis is shared with the other engines of the config
+	genesis := *e.conf.Genesis
+	e.conf.Genesis = &genesis
+	if genesis.Config == nil {
+		genesis.Config = rawdb.ReadChainConfig(disk, rawdb.ReadCanonicalHash(disk, 0))
+	}
+	genesis.Number = number + 1
+	genesis.Timestamp = header.Time + 1
+	genesis.GasLimit = header.GasLimit
+	genesis.Coinbase = header.Coinbase
+	genesis.Difficulty = header.Difficulty
+	genesis.BaseFee = nil
+	if genesis.Config != nil && genesis.Config.IsLondon(new(big.Int).SetUint64(genesis.Number)) {
+		genesis.BaseFee = misc.CalcBaseFee(genesis.Config, header)
+	}
+	e.getHash = func(n uint64) common.Hash {
+		return rawdb.ReadCanonicalHash(disk, n)
+	}
+
+	// the trie is resolved from the disk as the accounts and slots are accessed
+	e.statedb, err = state.New(header.Root, newStateDatabase(newOverlayDB(disk)), nil)
+	if err != nil {
+		return fmt.Errorf("state of block %d not found, it needs a recent block or an archive node: %v", number, err)
+	}
+	log.Info("forked", "block", number, "hash", hash, "root", header.Root)
+	return
+}
+
+// loadDump sets the accounts of a geth dump file, in its single object form or line by line
+// with --iterative. The accounts whose address is unknown, for lack of preimages, are skipped.
+func loadDump(statedb *state.StateDB, file string) (err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var accounts, skipped int
+	load := func(addr common.Address, account state.DumpAccount) error {
+		if !knownDumpAddress(addr, account) {
+			skipped++
+			return nil
+		}
+		accounts++
+		return setDumpAccount(statedb, addr, account)
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var value struct {
+			state.DumpAccount
+			// the state root, which the single object form doesn't prefix with 0x
+			Root     string                               `json:"root"`
+			Accounts map[common.Address]state.DumpAccount `json:"accounts"`
+		}
+		err = decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid dump %s: %v", file, err)
+		}
+
+		switch {
+		case value.Accounts != nil:
+			for addr, account := range value.Accounts {
+				if err = load(addr, account); err != nil {
+					return
+				}
+			}
+		case value.Address != nil:
+			err = load(*value.Address, value.DumpAccount)
+		case value.SecureKey != nil:
+			// the iterative form has no address for the zero address, like for the unknown ones
+			err = load(common.Address{}, value.DumpAccount)
+		default:
+			// the root line of the iterative form
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	statedb.Commit(true)
+	statedb.IntermediateRoot(true)
+	log.Info("dump loaded", "accounts", accounts, "skipped", skipped)
+	return nil
+}
+
+// knownDumpAddress tells whether a dumped account is really at addr: geth dumps the accounts
+// whose preimage is missing at the zero address, and the key of the account, which is the hash
+// of its address, tells them apart from the zero address itself.
+func knownDumpAddress(addr common.Address, account state.DumpAccount) bool {
+	if addr != (common.Address{}) {
+		return true
+	}
+	return bytes.Equal(account.SecureKey, crypto.Keccak256(addr[:]))
+}
+
+func setDumpAccount(statedb *state.StateDB, addr common.Address, account state.DumpAccount) error {
+	balance, ok := new(big.Int).SetString(account.Balance, 10)
+	if !ok {
+		return fmt.Errorf("invalid balance of %s: %s", addr.Hex(), account.Balance)
+	}
+	statedb.SetBalance(addr, balance)
+	statedb.SetNonce(addr, account.Nonce)
+	if len(account.Code) > 0 {
+		statedb.SetCode(addr, account.Code)
+	}
+	// the values are hex without prefix
+	for key, value := range account.Storage {
+		statedb.SetState(addr, key, common.BytesToHash(common.FromHex(value)))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package lab
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gotest.tools/assert"
+)
+
+func TestLoadDump(t *testing.T) {
+	// the same accounts, in the single object form and line by line, every one of them with its
+	// key, and 0x70997970c51812dc3a010c7d01b50e0d17dc79c8 without its preimage
+	for _, file := range []string{"testdata/dump.json", "testdata/dump_iterative.json"} {
+		statedb, err := state.New(common.Hash{}, newStateDatabase(rawdb.NewMemoryDatabase()), nil)
+		assert.NilError(t, err)
+		assert.NilError(t, loadDump(statedb, file), file)
+
+		eoa := common.HexToAddress("0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266")
+		assert.Equal(t, statedb.GetBalance(eoa).String(), big.NewInt(1e18).String(), file)
+		assert.Equal(t, statedb.GetNonce(eoa), uint64(3), file)
+
+		contract := common.HexToAddress("0x5fbdb2315678afecb367f032d93f642f64180aa3")
+		assert.Equal(t, common.Bytes2Hex(statedb.GetCode(contract)), common.Bytes2Hex(counterRuntime), file)
+		assert.Equal(t, statedb.GetState(contract, common.Hash{}), common.BigToHash(big.NewInt(2)), file)
+
+		// the account without preimage is skipped, not loaded at the zero address
+		assert.Assert(t, !statedb.Exist(common.Address{}), file)
+	}
+}
+
+func TestKnownDumpAddress(t *testing.T) {
+	zero := common.Address{}
+	unknown := common.HexToAddress("0x70997970c51812dc3a010c7d01b50e0d17dc79c8")
+
+	assert.Assert(t, knownDumpAddress(unknown, state.DumpAccount{SecureKey: crypto.Keccak256(unknown[:])}))
+	assert.Assert(t, !knownDumpAddress(zero, state.DumpAccount{SecureKey: crypto.Keccak256(unknown[:])}))
+	assert.Assert(t, !knownDumpAddress(zero, state.DumpAccount{}))
+	// the zero address is an account like the others
+	assert.Assert(t, knownDumpAddress(zero, state.DumpAccount{SecureKey: crypto.Keccak256(zero[:])}))
+}
@@ -0,0 +1,188 @@
+package lab
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+type profileStep struct {
+	// precompiles and accounts without code have no steps at all
+	codeless bool
+	op       vm.OpCode
+	gas      uint64
+	cost     uint64
+	location *srcmap.Location
+	function string
+}
+
+type profileFrame struct {
+	frame
+	call *CallGas
+	// the last step, whose gas is only known at the next step of the frame
+	pending *profileStep
+	// gas used by the sub calls since the pending step
+	childGas uint64
+	// self gas and gas of sub calls attributed so far
+	attributed uint64
+	// the last known solidity function of the frame
+	function string
+}
+
+// gasProfiler aggregates the gas of a tx by opcode, contract, call frame, and when
+// the source maps are available, by solidity function and line.
+//
+// The gas of a step is the difference of the gas available to it and to the next
+// step of the same frame, minus what the sub calls in between used. The last step
+// of a frame takes whatever is left of the gas used by the frame.
+type gasProfiler struct {
+	sources *sourceMaps
+	profile *GasProfile
+	frames  []*profileFrame
+	folded  map[string]uint64
+}
+
+func newGasProfiler(sources *sourceMaps) *gasProfiler {
+	return &gasProfiler{
+		sources: sources,
+		profile: &GasProfile{
+			ByOpcode:   make(map[string]uint64),
+			ByContract: make(map[string]uint64),
+			ByFunction: make(map[string]uint64),
+			ByLine:     make(map[string]uint64),
+		},
+		folded: make(map[string]uint64),
+	}
+}
+
+func (p *gasProfiler) enter(f frame) {
+	call := &CallGas{Type: f.typ.String(), From: f.from, To: f.to, Contract: p.sources.name(f.to)}
+	if len(p.frames) == 0 {
+		p.profile.Calls = call
+	} else {
+		parent := p.frames[len(p.frames)-1]
+		parent.call.Calls = append(parent.call.Calls, call)
+	}
+	p.frames = append(p.frames, &profileFrame{frame: f, call: call})
+}
+
+func (p *gasProfiler) exit(gasUsed uint64) {
+	if len(p.frames) == 0 {
+		return
+	}
+	f := p.frames[len(p.frames)-1]
+	p.frames = p.frames[:len(p.frames)-1]
+
+	var remainder uint64
+	if gasUsed > f.attributed {
+		remainder = gasUsed - f.attributed
+	}
+	if f.pending != nil {
+		p.attribute(f, f.pending, remainder)
+	} else {
+		p.attribute(f, &profileStep{codeless: true}, remainder)
+	}
+	f.call.GasUsed = gasUsed
+
+	if len(p.frames) > 0 {
+		parent := p.frames[len(p.frames)-1]
+		parent.childGas += gasUsed
+		parent.attributed += gasUsed
+	}
+}
+
+func (p *gasProfiler) attribute(f *profileFrame, step *profileStep, gas uint64) {
+	f.attributed += gas
+	f.call.SelfGas += gas
+
+	if !step.codeless {
+		p.profile.ByOpcode[step.op.String()] += gas
+	}
+	p.profile.ByContract[f.call.Contract] += gas
+	if step.location != nil {
+		p.profile.ByLine[fmt.Sprintf("%s:%d", step.location.File, step.location.Line)] += gas
+	}
+	if step.function != "" {
+		p.profile.ByFunction[step.function] += gas
+	}
+
+	var stack []string
+	for _, frame := range p.frames {
+		if frame == f {
+			break
+		}
+		stack = append(stack, frameLabel(frame.call.Contract, frame.function))
+	}
+	stack = append(stack, frameLabel(f.call.Contract, step.function))
+	p.folded[strings.Join(stack, ";")] += gas
+}
+
+func frameLabel(contract, function string) string {
+	if function == "" {
+		return contract
+	}
+	return contract + ":" + function
+}
+
+// result returns the profile, which is complete once the execution ends.
+func (p *gasProfiler) result(intrinsicGas uint64) *GasProfile {
+	p.profile.IntrinsicGas = intrinsicGas
+	p.profile.Folded = nil
+	for stack, gas := range p.folded {
+		if gas > 0 {
+			p.profile.Folded = append(p.profile.Folded, fmt.Sprintf("%s %d", stack, gas))
+		}
+	}
+	sort.Strings(p.profile.Folded)
+	return p.profile
+}
+
+func (p *gasProfiler) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	p.enter(frame{typ: typ, from: from, to: to, create: create})
+}
+
+func (p *gasProfiler) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if len(p.frames) == 0 {
+		return
+	}
+	f := p.frames[len(p.frames)-1]
+	if f.pending != nil {
+		self := f.pending.cost
+		if f.pending.gas >= gas+f.childGas {
+			self = f.pending.gas - gas - f.childGas
+		}
+		p.attribute(f, f.pending, self)
+	}
+	f.childGas = 0
+
+	location := p.sources.location(codeAddress(scope), scope.Contract.Code, f.create, pc)
+	if location != nil && location.Function != "" {
+		f.function = location.Function
+	}
+	f.pending = &profileStep{op: op, gas: gas, cost: cost, location: location, function: f.function}
+}
+
+func (p *gasProfiler) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	p.enter(frame{typ: typ, from: from, to: to, create: isCreate(typ)})
+}
+
+func (p *gasProfiler) CaptureExit(output []byte, gasUsed uint64, err error) {
+	p.exit(gasUsed)
+}
+
+func (p *gasProfiler) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (p *gasProfiler) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {
+	p.exit(gasUsed)
+}
@@ -0,0 +1,418 @@
+package lab
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+// DeployInput ...
+type DeployInput struct {
+	Sender       common.Address
+	CodeAndInput []byte
+	// gas limit of the tx, capped by the block gas limit, which is also the default
+	Gas      uint64
+	GasPrice *big.Int
+	Value    *big.Int
+	// EIP-1559 fee caps, mutually exclusive with GasPrice
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	// EIP-2930 access list
+	AccessList types.AccessList
+	// source maps of the contract, optional
+	Artifact *srcmap.Artifact
+	// collect a GasProfile
+	Profile bool
+	// return the StateDiff of the tx
+	StateDiff bool
+}
+
+// DeployOutput ...
+type DeployOutput struct {
+	Addr common.Address
+	// gas charged for the tx, including the intrinsic gas, after the refund
+	GasUsed   uint64
+	StateDiff *StateDiff  `json:",omitempty"`
+	Profile   *GasProfile `json:",omitempty"`
+	// lines printed with console.log, also when the tx reverted
+	Console []string `json:",omitempty"`
+	// events emitted by the tx, when it succeeded
+	Logs   []Log `json:",omitempty"`
+	ErrMsg string
+	// where the tx reverted, only available for the contracts deployed with their artifact
+	RevertLocation *srcmap.Location `json:",omitempty"`
+}
+
+// CallInput ...
+type CallInput struct {
+	Input []byte
+	// gas limit of the tx, capped by the block gas limit, which is also the default
+	Gas      uint64
+	Sender   common.Address
+	Receiver common.Address
+	GasPrice *big.Int
+	Value    *big.Int
+	// EIP-1559 fee caps, mutually exclusive with GasPrice
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	// EIP-2930 access list
+	AccessList types.AccessList
+	// collect a GasProfile
+	Profile bool
+	// return the StateDiff of the tx
+	StateDiff bool
+}
+
+// CallOutput ...
+type CallOutput struct {
+	Result []byte
+	// gas charged for the tx, including the intrinsic gas, after the refund
+	GasUsed   uint64
+	StateDiff *StateDiff  `json:",omitempty"`
+	Profile   *GasProfile `json:",omitempty"`
+	// lines printed with console.log, also when the tx reverted
+	Console []string `json:",omitempty"`
+	// events emitted by the tx, when it succeeded
+	Logs   []Log `json:",omitempty"`
+	ErrMsg string
+	// where the tx reverted, only available for the contracts deployed with their artifact
+	RevertLocation *srcmap.Location `json:",omitempty"`
+}
+
+// SendRawTransactionInput has a signed tx, legacy or typed, in its binary encoding
+type SendRawTransactionInput struct {
+	Tx hexutil.Bytes
+}
+
+// SendRawTransactionOutput ...
+type SendRawTransactionOutput struct {
+	Hash   common.Hash
+	Sender common.Address
+	// the contract created, for a deploy
+	Addr *common.Address `json:",omitempty"`
+	// whether the tx passed the nonce, fee and balance checks, it is charged even if it reverted
+	Executed bool
+	Result   hexutil.Bytes
+	// gas charged for the tx, including the intrinsic gas, after the refund
+	GasUsed uint64
+	// lines printed with console.log, also when the tx reverted
+	Console []string `json:",omitempty"`
+	// events emitted by the tx, when it succeeded
+	Logs   []Log `json:",omitempty"`
+	ErrMsg string
+	// where the tx reverted, only available for the contracts deployed with their artifact
+	RevertLocation *srcmap.Location `json:",omitempty"`
+}
+
+// ChainInfoOutput has what the txs are signed with, and the block they are executed in
+type ChainInfoOutput struct {
+	ChainID *big.Int
+	Number  uint64
+	// nil before london
+	BaseFee *big.Int
+}
+
+// Log is an event emitted by a tx
+type Log struct {
+	Address common.Address
+	Topics  []common.Hash
+	Data    hexutil.Bytes
+}
+
+// GasProfile aggregates the gas of a tx. Except for the call tree, the numbers are self gas,
+// i.e. excluding the gas of sub calls, and only cover the execution, not the intrinsic gas.
+type GasProfile struct {
+	IntrinsicGas uint64
+	ByOpcode     map[string]uint64
+	// by contract name, or address when the contract was not deployed with its artifact
+	ByContract map[string]uint64
+	// by solidity function and file:line, when the source maps are available
+	ByFunction map[string]uint64
+	ByLine     map[string]uint64
+	Calls      *CallGas
+	// folded stacks, as consumed by flamegraph.pl
+	Folded []string
+}
+
+// CallGas is the gas of a call frame
+type CallGas struct {
+	Type     string
+	From     common.Address
+	To       common.Address
+	Contract string
+	// including the sub calls
+	GasUsed uint64
+	SelfGas uint64
+	Calls   []*CallGas `json:",omitempty"`
+}
+
+// AccessListOutput ...
+type AccessListOutput struct {
+	AccessList types.AccessList
+	// gas used with the generated access list, including the intrinsic gas
+	GasUsed uint64
+	// gas used with the access list of the input
+	GasUsedWithInputList uint64
+	// negative when the generated access list costs more than it saves
+	GasSaved int64
+	ErrMsg   string
+}
+
+// EstimateGasInput carries either a deploy or a call
+type EstimateGasInput struct {
+	Deploy *DeployInput
+	Call   *CallInput
+}
+
+func (input *EstimateGasInput) gas() uint64 {
+	if input.Deploy != nil {
+		return input.Deploy.Gas
+	}
+	return input.Call.Gas
+}
+
+// EstimateGasOutput ...
+type EstimateGasOutput struct {
+	// minimum gas limit for the tx to succeed, including the intrinsic gas
+	Gas          uint64
+	IntrinsicGas uint64
+	// gas charged with the minimum gas limit, after the refund
+	GasUsed uint64
+	Refund  uint64
+	ErrMsg  string
+}
+
+// DebugStartInput carries either a deploy or a call to debug
+type DebugStartInput struct {
+	Deploy *DeployInput
+	Call   *CallInput
+}
+
+// debug commands
+const (
+	// DebugStep executes one instruction
+	DebugStep = "step"
+	// DebugNext executes one instruction, stepping over the sub call it makes
+	DebugNext = "next"
+	// DebugOut runs until the current call frame returns
+	DebugOut = "out"
+	// DebugContinue runs until a breakpoint is hit
+	DebugContinue = "continue"
+	// DebugStop aborts the execution
+	DebugStop = "stop"
+)
+
+// Breakpoint pauses the execution at a pc, an opcode, or a solidity line.
+// A line breakpoint is hit when the execution enters the line.
+type Breakpoint struct {
+	PC   *uint64 `json:",omitempty"`
+	Op   string  `json:",omitempty"`
+	File string  `json:",omitempty"`
+	Line int     `json:",omitempty"`
+}
+
+// DebugCommandInput ...
+type DebugCommandInput struct {
+	Session string
+	Command string
+	// replaces the breakpoints of the session when not nil
+	Breakpoints []Breakpoint
+}
+
+// DebugFrame is a call frame of the call stack, outermost first
+type DebugFrame struct {
+	Type     string
+	From     common.Address
+	To       common.Address
+	Contract string
+	// where the frame is at, which is the call site for the outer frames
+	Location *srcmap.Location `json:",omitempty"`
+}
+
+// DebugState is the state of a paused execution, before the instruction at PC is executed
+type DebugState struct {
+	PC    uint64
+	Op    string
+	Gas   uint64
+	Cost  uint64
+	Depth int
+	// top of the stack last
+	Stack  []string
+	Memory hexutil.Bytes
+	// slots of the current contract accessed so far
+	Storage   map[common.Hash]common.Hash
+	Location  *srcmap.Location `json:",omitempty"`
+	CallStack []DebugFrame
+}
+
+// DebugOutput is either the paused state, or the result once the execution is done
+type DebugOutput struct {
+	Session string
+	State   *DebugState `json:",omitempty"`
+	Done    bool
+	Result  []byte
+	Addr    common.Address
+	GasUsed uint64
+	ErrMsg  string
+}
+
+// TraceFilter selects the events streamed by a trace, the zero value selects all of them
+type TraceFilter struct {
+	// opcodes of the steps, all of them if empty
+	Ops []string
+	// 1 is the depth of the tx itself, 0 means no limit
+	MinDepth int
+	MaxDepth int
+	// code addresses of the steps, and callees of the frames, all of them if empty
+	Addresses []common.Address
+	// include the stack in the steps
+	Stack bool
+}
+
+// TraceInput carries either a deploy or a call to trace
+type TraceInput struct {
+	Deploy *DeployInput
+	Call   *CallInput
+	Filter TraceFilter
+}
+
+// TraceStep ...
+type TraceStep struct {
+	Depth    int
+	Address  common.Address
+	PC       uint64
+	Op       string
+	Gas      uint64
+	Cost     uint64
+	Stack    []string         `json:",omitempty"`
+	Location *srcmap.Location `json:",omitempty"`
+	Error    string           `json:",omitempty"`
+}
+
+// TraceEnter ...
+type TraceEnter struct {
+	Depth int
+	Type  string
+	From  common.Address
+	To    common.Address
+	Input hexutil.Bytes
+	Value *hexutil.Big
+	Gas   uint64
+}
+
+// TraceExit ...
+type TraceExit struct {
+	Depth   int
+	Output  hexutil.Bytes
+	GasUsed uint64
+	Error   string `json:",omitempty"`
+}
+
+// TraceEnd is the result of the traced tx
+type TraceEnd struct {
+	Result  hexutil.Bytes
+	Addr    common.Address
+	GasUsed uint64
+	ErrMsg  string
+}
+
+// TraceConsole is a line printed with console.log
+type TraceConsole struct {
+	// depth of the frame calling console.log
+	Depth   int
+	Address common.Address
+	Line    string
+}
+
+// TraceEvent has exactly one of its fields set
+type TraceEvent struct {
+	Step    *TraceStep    `json:",omitempty"`
+	Enter   *TraceEnter   `json:",omitempty"`
+	Exit    *TraceExit    `json:",omitempty"`
+	Console *TraceConsole `json:",omitempty"`
+	End     *TraceEnd     `json:",omitempty"`
+}
+
+// AccountState has the fields of an account that changed
+type AccountState struct {
+	Balance *hexutil.Big                `json:",omitempty"`
+	Nonce   *uint64                     `json:",omitempty"`
+	Code    hexutil.Bytes               `json:",omitempty"`
+	Storage map[common.Hash]common.Hash `json:",omitempty"`
+}
+
+// StateDiff has the changed accounts before and after a tx
+type StateDiff struct {
+	Pre  map[common.Address]*AccountState
+	Post map[common.Address]*AccountState
+}
+
+// CoverageInput ...
+type CoverageInput struct {
+	// clear the coverage once returned
+	Reset bool
+}
+
+// CoverageOutput has the coverage of the solidity files of the contracts deployed with their artifacts
+type CoverageOutput struct {
+	Files []*srcmap.FileCoverage
+}
+
+// SetStateInput overwrites the fields of an account which are set in State
+type SetStateInput struct {
+	Address common.Address
+	State   AccountState
+}
+
+// SetStateOutput ...
+type SetStateOutput struct {
+	ErrMsg string
+}
+
+// GetStateInput ...
+type GetStateInput struct {
+	Address common.Address
+	// the storage slots to return
+	Storage []common.Hash
+}
+
+// GetStateOutput has every field of State set, Storage having the slots of the input
+type GetStateOutput struct {
+	State AccountState
+}
+
+// ExportStateOutput has the genesis of the lab with the current state as its alloc
+type ExportStateOutput struct {
+	Genesis *core.Genesis `json:",omitempty"`
+	ErrMsg  string
+}
+
+// ImportStateInput replaces the lab state with the alloc of Genesis
+type ImportStateInput struct {
+	Genesis *core.Genesis
+}
+
+// ImportStateOutput ...
+type ImportStateOutput struct {
+	ErrMsg string
+}
+
+// SnapshotOutput ...
+type SnapshotOutput struct {
+	ID uint64
+}
+
+// RevertInput ...
+type RevertInput struct {
+	// as returned by the snapshot, which is kept, so it can be reverted to again
+	ID uint64
+}
+
+// RevertOutput ...
+type RevertOutput struct {
+	ErrMsg string
+}
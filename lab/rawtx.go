@@ -0,0 +1,100 @@
+package lab
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// handleChainInfo returns what a wallet needs to sign the txs of handleSendRawTransaction.
+func (e *Engine) handleChainInfo() ChainInfoOutput {
+	block := e.block()
+	return ChainInfoOutput{ChainID: block.chainConfig().ChainID, Number: block.genesis.Number, BaseFee: block.baseFee()}
+}
+
+// handleSendRawTransaction executes a signed tx the way a node includes it in the lab block:
+// the sender is recovered with the chain ID of the config, the nonce must be the next one, and
+// the gas is bought from the balance, the fee going to the coinbase. A tx rejected by those
+// checks doesn't change the state, while a reverted one is charged like on chain.
+func (e *Engine) handleSendRawTransaction(input SendRawTransactionInput) (output SendRawTransactionOutput) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input.Tx); err != nil {
+		output.ErrMsg = fmt.Sprintf("invalid tx: %v", err)
+		return
+	}
+	output.Hash = tx.Hash()
+
+	number := new(big.Int).SetUint64(e.conf.Genesis.Number)
+	block := e.block()
+	signer := types.MakeSigner(block.chainConfig(), number)
+	msg, err := tx.AsMessage(signer, block.baseFee())
+	if err != nil {
+		output.ErrMsg = fmt.Sprintf("invalid sender: %v", err)
+		return
+	}
+	output.Sender = msg.From()
+	if tx.To() == nil {
+		addr := crypto.CreateAddress(msg.From(), tx.Nonce())
+		output.Addr = &addr
+	}
+
+	// no cheatcodes, the tx runs as it would on chain
+	tracers := e.newTxTracers(false, false, false, false)
+
+	gasLimit := block.blockGasLimit()
+	if gasLimit == 0 {
+		gasLimit = math.MaxUint64
+	}
+	blockContext := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     block.blockHash,
+		Coinbase:    e.conf.Genesis.Coinbase,
+		GasLimit:    gasLimit,
+		BlockNumber: number,
+		Time:        new(big.Int).SetUint64(e.conf.Genesis.Timestamp),
+		Difficulty:  e.conf.Genesis.Difficulty,
+		BaseFee:     block.baseFee(),
+	}
+	if blockContext.Difficulty == nil {
+		blockContext.Difficulty = new(big.Int)
+	}
+	evm := vm.NewEVM(blockContext, core.NewEVMTxContext(msg), e.statedb, block.chainConfig(), vm.Config{
+		Tracer: tracers.evm,
+		Debug:  tracers.evm != nil,
+	})
+
+	e.statedb.Prepare(tx.Hash(), 0)
+	snapshot := e.statedb.Snapshot()
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(gasLimit))
+	if err != nil {
+		// the gas may have been bought already
+		e.statedb.RevertToSnapshot(snapshot)
+		output.ErrMsg = err.Error()
+		return
+	}
+	output.Executed = true
+	output.Result = result.ReturnData
+	output.GasUsed = result.UsedGas
+	output.Console = tracers.console.texts()
+	if result.Failed() {
+		output.ErrMsg = parseRevertReason(result.Err, result.Revert())
+		output.RevertLocation = tracers.src.revertLocation()
+	} else {
+		output.Logs = txLogs(e.statedb, tx.Hash())
+	}
+
+	e.statedb.Commit(true)
+	e.statedb.IntermediateRoot(true)
+
+	tracers.writeTrace()
+	if !e.conf.Quiet {
+		fmt.Println("raw tx", output.Hash.Hex(), "sender", output.Sender.Hex(), "gas used", output.GasUsed)
+	}
+	return
+}
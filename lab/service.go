@@ -0,0 +1,318 @@
+package lab
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	goruntime "runtime"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+)
+
+// txTracers are the tracers of a tx which is committed, chained by newTxTracers.
+type txTracers struct {
+	// the trace of --machine or --debug, nil without either
+	trace       vm.EVMLogger
+	debugLogger *logger.StructLogger
+	src         *sourceTracer
+	cheats      *cheatcodes
+	console     *consoleTracer
+	profiler    *gasProfiler
+	diff        *stateDiffTracer
+	// all of the above, for the EVM
+	evm vm.EVMLogger
+}
+
+// newTxTracers chains the tracers of a tx for the config, plus the cheatcodes, gas profiler
+// and state diff if asked. artifact tells whether the tx deploys a contract with its artifact.
+func (e *Engine) newTxTracers(artifact, cheatcodes, profile, stateDiff bool) *txTracers {
+	logconfig := &logger.Config{
+		EnableMemory:     !e.conf.DisableMemory,
+		DisableStack:     e.conf.DisableStack,
+		DisableStorage:   e.conf.DisableStorage,
+		EnableReturnData: !e.conf.DisableReturnData,
+		Debug:            e.conf.Debug,
+	}
+
+	t := &txTracers{}
+	if artifact || e.sources.hasArtifacts() {
+		t.src = newSourceTracer(e.sources, e.conf.Machine || e.conf.Debug)
+	}
+	if e.conf.Machine {
+		t.trace = logger.NewJSONLogger(logconfig, newSourceJSONWriter(os.Stdout, t.src))
+	} else if e.conf.Debug {
+		t.debugLogger = logger.NewStructLogger(logconfig)
+		t.trace = t.debugLogger
+	}
+
+	var tracers []vm.EVMLogger
+	// the cheatcodes go first, so that the other tracers see their effect
+	if cheatcodes {
+		t.cheats = newCheatcodes(e.sources)
+		tracers = append(tracers, t.cheats)
+	}
+	// the locations go before the trace, which is annotated with them
+	if t.src != nil {
+		tracers = append(tracers, t.src)
+	}
+	tracers = append(tracers, t.trace)
+	// tracing slows the EVM down, so console.log is not collected when benchmarking
+	if !e.conf.Bench {
+		t.console = newConsoleTracer()
+		tracers = append(tracers, t.console)
+	}
+	if profile {
+		t.profiler = newGasProfiler(e.sources)
+		tracers = append(tracers, t.profiler)
+	}
+	if stateDiff {
+		t.diff = newStateDiffTracer(e.statedb.Copy())
+		tracers = append(tracers, t.diff)
+	}
+	if e.conf.Coverage {
+		tracers = append(tracers, newCoverageTracer(e.coverage))
+	}
+	t.evm = newMultiTracer(tracers...)
+	return t
+}
+
+// writeTrace writes the trace of --debug to stderr, if any.
+func (t *txTracers) writeTrace() {
+	if t.debugLogger == nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "#### TRACE ####")
+	writeTrace(os.Stderr, t.debugLogger.StructLogs(), t.src.stepLocations(), t.console)
+}
+
+func (e *Engine) handleDeploy(input DeployInput) (output DeployOutput) {
+	tracers := e.newTxTracers(input.Artifact != nil, e.conf.Cheatcodes, input.Profile, input.StateDiff)
+
+	if !e.conf.Quiet {
+		fmt.Println("sender", input.Sender.Hex(), "balance", e.statedb.GetBalance(input.Sender), "nonce", e.statedb.GetNonce(input.Sender))
+	}
+
+	block := e.block()
+	execGas, intrinsicGas, err := block.buyGas(input.Gas, input.CodeAndInput, input.AccessList, true)
+	if err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+
+	runtimeConfig, err := block.newRuntimeConfig(e.statedb, input.Sender, execGas, input.Value, input.GasPrice, input.MaxFeePerGas, input.MaxPriorityFeePerGas, input.AccessList, tracers.evm)
+	if err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+
+	// the source maps are needed during the deploy already
+	e.sources.register(crypto.CreateAddress(input.Sender, e.statedb.GetNonce(input.Sender)), input.Artifact)
+
+	execFunc := func() ([]byte, uint64, error) {
+		outputBytes, addr, gasLeft, err := applyCreate(runtimeConfig, input.CodeAndInput, input.AccessList)
+		output.Addr = addr
+		return outputBytes, gasLeft, err
+	}
+
+	txHash := e.nextTxHash()
+	e.statedb.Prepare(txHash, 0)
+	snapshot := e.statedb.Snapshot()
+	outputBytes, leftOverGas, stats, err := timedExec(e.conf.Bench, execFunc)
+	output.GasUsed = intrinsicGas + execGas - leftOverGas
+	output.Console = tracers.console.texts()
+	if tracers.profiler != nil {
+		output.Profile = tracers.profiler.result(intrinsicGas)
+	}
+	if err == nil && tracers.cheats != nil && tracers.cheats.failure != "" {
+		// a failed expectation fails the tx, without any of its changes
+		e.statedb.RevertToSnapshot(snapshot)
+		output.ErrMsg = tracers.cheats.failure
+		return
+	}
+	if err != nil {
+		output.ErrMsg = parseRevertReason(err, outputBytes)
+		output.RevertLocation = tracers.src.revertLocation()
+		tracers.writeTrace()
+		return
+	}
+	output.GasUsed -= block.refund(e.statedb, output.GasUsed)
+
+	output.Logs = txLogs(e.statedb, txHash)
+
+	e.statedb.Commit(true)
+	e.statedb.IntermediateRoot(true)
+	if tracers.diff != nil {
+		output.StateDiff = tracers.diff.diff(e.statedb)
+	}
+
+	if e.conf.Dump {
+		fmt.Println(string(e.statedb.Dump(nil)))
+	}
+
+	if e.conf.Debug {
+		tracers.writeTrace()
+		fmt.Fprintln(os.Stderr, "#### LOGS ####")
+		logger.WriteLogs(os.Stderr, e.statedb.Logs())
+	}
+
+	if e.conf.Bench || e.conf.StatDump {
+		fmt.Fprintf(os.Stderr, `EVM gas used:    %d
+execution time:  %v
+allocations:     %d
+allocated bytes: %d
+`, output.GasUsed, stats.time, stats.allocs, stats.bytesAllocated)
+	}
+	if tracers.trace == nil && !e.conf.Quiet {
+		fmt.Printf("0x%x\n", outputBytes)
+		if err != nil {
+			fmt.Printf(" error: %v\n", err)
+		}
+	}
+	return
+}
+
+// FYI: https://coder-question.com/cq-blog/194033
+func parseRevertReason(revertErr error, returnData []byte) string {
+	StringTy, _ := abi.NewType("string", "", nil)
+
+	param := abi.Arguments{
+		{Type: StringTy},
+	}
+	if len(returnData) < 4 {
+		return fmt.Sprintf("Error:%v Raw:%v", revertErr, returnData)
+	}
+	args, err := param.Unpack(returnData[4:])
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	} else {
+		msg = args[0].(string)
+	}
+	return fmt.Sprintf("Error:%v Method:0x%s Msg:'%s' Raw:%v", revertErr, hex.EncodeToString(returnData[0:4]), msg, returnData)
+}
+
+type execStats struct {
+	time           time.Duration // The execution time.
+	allocs         int64         // The number of heap allocations during execution.
+	bytesAllocated int64         // The cumulative number of bytes allocated during execution.
+}
+
+func timedExec(bench bool, execFunc func() ([]byte, uint64, error)) (output []byte, gasLeft uint64, stats execStats, err error) {
+	if bench {
+		result := testing.Benchmark(func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				output, gasLeft, err = execFunc()
+			}
+		})
+
+		// Get the average execution time from the benchmarking result.
+		// There are other useful stats here that could be reported.
+		stats.time = time.Duration(result.NsPerOp())
+		stats.allocs = result.AllocsPerOp()
+		stats.bytesAllocated = result.AllocedBytesPerOp()
+	} else {
+		var memStatsBefore, memStatsAfter goruntime.MemStats
+		goruntime.ReadMemStats(&memStatsBefore)
+		startTime := time.Now()
+		output, gasLeft, err = execFunc()
+		stats.time = time.Since(startTime)
+		goruntime.ReadMemStats(&memStatsAfter)
+		stats.allocs = int64(memStatsAfter.Mallocs - memStatsBefore.Mallocs)
+		stats.bytesAllocated = int64(memStatsAfter.TotalAlloc - memStatsBefore.TotalAlloc)
+	}
+
+	return output, gasLeft, stats, err
+}
+
+// handleStaticCall runs the call like eth_call does, against a copy of the state which is dropped.
+func (e *Engine) handleStaticCall(input CallInput) CallOutput {
+	statedb := e.statedb
+	e.statedb = statedb.Copy()
+	defer func() { e.statedb = statedb }()
+
+	return e.handleCall(input)
+}
+
+func (e *Engine) handleCall(input CallInput) (output CallOutput) {
+	tracers := e.newTxTracers(false, e.conf.Cheatcodes, input.Profile, input.StateDiff)
+	// e.statedb.CreateAccount(input.Sender)
+
+	block := e.block()
+	execGas, intrinsicGas, err := block.buyGas(input.Gas, input.Input, input.AccessList, false)
+	if err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+
+	runtimeConfig, err := block.newRuntimeConfig(e.statedb, input.Sender, execGas, input.Value, input.GasPrice, input.MaxFeePerGas, input.MaxPriorityFeePerGas, input.AccessList, tracers.evm)
+	if err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+
+	execFunc := func() ([]byte, uint64, error) {
+		return applyCall(runtimeConfig, input.Receiver, input.Input, input.AccessList)
+	}
+
+	txHash := e.nextTxHash()
+	e.statedb.Prepare(txHash, 0)
+	snapshot := e.statedb.Snapshot()
+	outputBytes, leftOverGas, stats, err := timedExec(e.conf.Bench, execFunc)
+	output.Result = outputBytes
+	output.GasUsed = intrinsicGas + execGas - leftOverGas
+	output.Console = tracers.console.texts()
+	if tracers.profiler != nil {
+		output.Profile = tracers.profiler.result(intrinsicGas)
+	}
+	if err == nil && tracers.cheats != nil && tracers.cheats.failure != "" {
+		// a failed expectation fails the tx, without any of its changes
+		e.statedb.RevertToSnapshot(snapshot)
+		output.ErrMsg = tracers.cheats.failure
+		return
+	}
+	if err != nil {
+		output.ErrMsg = parseRevertReason(err, outputBytes)
+		output.RevertLocation = tracers.src.revertLocation()
+		tracers.writeTrace()
+		return
+	}
+	output.GasUsed -= block.refund(e.statedb, output.GasUsed)
+
+	output.Logs = txLogs(e.statedb, txHash)
+
+	e.statedb.Commit(true)
+	e.statedb.IntermediateRoot(true)
+	if tracers.diff != nil {
+		output.StateDiff = tracers.diff.diff(e.statedb)
+	}
+	if e.conf.Dump {
+		fmt.Println(string(e.statedb.Dump(nil)))
+	}
+
+	if e.conf.Debug {
+		tracers.writeTrace()
+		fmt.Fprintln(os.Stderr, "#### LOGS ####")
+		logger.WriteLogs(os.Stderr, e.statedb.Logs())
+	}
+
+	if e.conf.Bench || e.conf.StatDump {
+		fmt.Fprintf(os.Stderr, `EVM gas used:    %d
+execution time:  %v
+allocations:     %d
+allocated bytes: %d
+`, output.GasUsed, stats.time, stats.allocs, stats.bytesAllocated)
+	}
+	if tracers.trace == nil && !e.conf.Quiet {
+		fmt.Printf("0x%x\n", outputBytes)
+		if err != nil {
+			fmt.Printf(" error: %v\n", err)
+		}
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package lab
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/state"
+)
+
+// snapshots are copies of the lab state by id, which can be reverted to any number of times.
+type snapshots struct {
+	nextID uint64
+	states map[uint64]*state.StateDB
+}
+
+func newSnapshots() *snapshots {
+	return &snapshots{states: make(map[uint64]*state.StateDB)}
+}
+
+func (e *Engine) snapshot() uint64 {
+	e.snapshots.nextID++
+	e.snapshots.states[e.snapshots.nextID] = e.statedb.Copy()
+	return e.snapshots.nextID
+}
+
+func (e *Engine) revert(id uint64) error {
+	statedb, ok := e.snapshots.states[id]
+	if !ok {
+		return fmt.Errorf("snapshot %d not found", id)
+	}
+	e.statedb = statedb.Copy()
+	return nil
+}
@@ -0,0 +1,120 @@
+package lab
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+type mapperKey struct {
+	addr   common.Address
+	create bool
+}
+
+// sourceMaps resolves the pcs of lab contracts to solidity locations,
+// with the artifacts uploaded along with the deploys.
+// It's shared by the debug sessions, which run outside of the engine lock.
+type sourceMaps struct {
+	sync.Mutex
+	artifacts map[common.Address]*srcmap.Artifact
+	mappers   map[mapperKey]*srcmap.Mapper
+	// names given by the label cheatcode
+	labels map[common.Address]string
+}
+
+func newSourceMaps() *sourceMaps {
+	return &sourceMaps{
+		artifacts: make(map[common.Address]*srcmap.Artifact),
+		mappers:   make(map[mapperKey]*srcmap.Mapper),
+		labels:    make(map[common.Address]string),
+	}
+}
+
+// copy returns a copy with the same artifacts and labels, the mappers are built again on demand.
+func (m *sourceMaps) copy() *sourceMaps {
+	m.Lock()
+	defer m.Unlock()
+	c := newSourceMaps()
+	for addr, artifact := range m.artifacts {
+		c.artifacts[addr] = artifact
+	}
+	for addr, label := range m.labels {
+		c.labels[addr] = label
+	}
+	return c
+}
+
+func (m *sourceMaps) register(addr common.Address, artifact *srcmap.Artifact) {
+	if artifact == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.artifacts[addr] = artifact
+	delete(m.mappers, mapperKey{addr: addr})
+	delete(m.mappers, mapperKey{addr: addr, create: true})
+}
+
+// hasArtifacts tells whether any contract can be resolved to solidity locations.
+func (m *sourceMaps) hasArtifacts() bool {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.artifacts) > 0
+}
+
+func (m *sourceMaps) label(addr common.Address, label string) {
+	m.Lock()
+	defer m.Unlock()
+	m.labels[addr] = label
+}
+
+// name returns the label or contract name of addr, or its hex when unknown.
+func (m *sourceMaps) name(addr common.Address) string {
+	m.Lock()
+	defer m.Unlock()
+	if label, ok := m.labels[addr]; ok {
+		return label
+	}
+	if artifact := m.artifacts[addr]; artifact != nil && artifact.Name != "" {
+		return artifact.Name
+	}
+	return addr.Hex()
+}
+
+// location returns the solidity location of pc, nil when unknown.
+// code is the creation code when create is true, otherwise the runtime code of addr.
+func (m *sourceMaps) location(addr common.Address, code []byte, create bool, pc uint64) *srcmap.Location {
+	m.Lock()
+	defer m.Unlock()
+
+	mapper := m.lockedMapper(addr, code, create)
+	if mapper == nil {
+		return nil
+	}
+	return mapper.Location(pc)
+}
+
+// mapper returns the mapper of code, nil when addr was deployed without its artifact.
+func (m *sourceMaps) mapper(addr common.Address, code []byte, create bool) *srcmap.Mapper {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.lockedMapper(addr, code, create)
+}
+
+func (m *sourceMaps) lockedMapper(addr common.Address, code []byte, create bool) *srcmap.Mapper {
+	key := mapperKey{addr: addr, create: create}
+	mapper, ok := m.mappers[key]
+	if !ok {
+		if artifact := m.artifacts[addr]; artifact != nil {
+			srcMap := artifact.SrcMapRuntime
+			if create {
+				srcMap = artifact.SrcMap
+			}
+			mapper = srcmap.NewMapper(code, srcMap, artifact.Sources)
+		}
+		m.mappers[key] = mapper
+	}
+	return mapper
+}
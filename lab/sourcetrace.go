@@ -0,0 +1,157 @@
+package lab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+)
+
+// sourceTracer records the solidity location where the tx reverted and, when a trace is
+// written, the location of every step, in the same order as the struct logs, so that the
+// trace can be annotated with the source.
+type sourceTracer struct {
+	sources *sourceMaps
+	frames  []frame
+	// whether the locations of the steps are recorded
+	steps     bool
+	locations []*srcmap.Location
+	// where the innermost error, like a failed require, was raised, the frames reverting
+	// in turn as it bubbles up don't replace it
+	fault      *srcmap.Location
+	faultDepth int
+}
+
+func newSourceTracer(sources *sourceMaps, steps bool) *sourceTracer {
+	return &sourceTracer{sources: sources, steps: steps}
+}
+
+func (t *sourceTracer) location(pc uint64, scope *vm.ScopeContext) *srcmap.Location {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	return t.sources.location(codeAddress(scope), scope.Contract.Code, t.frames[len(t.frames)-1].create, pc)
+}
+
+func (t *sourceTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.frames = append(t.frames, frame{from: from, to: to, create: create})
+}
+
+func (t *sourceTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if !t.steps {
+		if err != nil {
+			t.setFault(t.location(pc, scope), depth)
+		}
+		return
+	}
+	location := t.location(pc, scope)
+	t.locations = append(t.locations, location)
+	if err != nil {
+		t.setFault(location, depth)
+	}
+}
+
+func (t *sourceTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.frames = append(t.frames, frame{typ: typ, from: from, to: to, create: isCreate(typ)})
+}
+
+func (t *sourceTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if len(t.frames) > 0 {
+		t.frames = t.frames[:len(t.frames)-1]
+	}
+}
+
+func (t *sourceTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	t.setFault(t.location(pc, scope), depth)
+}
+
+func (t *sourceTracer) setFault(location *srcmap.Location, depth int) {
+	if t.fault != nil && t.faultDepth > depth {
+		return
+	}
+	t.fault, t.faultDepth = location, depth
+}
+
+// revertLocation is where the tx reverted, nil when unknown.
+func (t *sourceTracer) revertLocation() *srcmap.Location {
+	if t == nil {
+		return nil
+	}
+	return t.fault
+}
+
+// stepLocations are the locations of the steps so far, in the order of the struct logs.
+func (t *sourceTracer) stepLocations() []*srcmap.Location {
+	if t == nil {
+		return nil
+	}
+	return t.locations
+}
+
+func (t *sourceTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	t.frames = nil
+}
+
+// sourceJSONWriter adds the solidity location of each step to the json lines written by
+// logger.JSONLogger, which comes after the sourceTracer in the tracers.
+type sourceJSONWriter struct {
+	w   io.Writer
+	src *sourceTracer
+}
+
+func newSourceJSONWriter(w io.Writer, src *sourceTracer) io.Writer {
+	if src == nil {
+		return w
+	}
+	return &sourceJSONWriter{w: w, src: src}
+}
+
+func (w *sourceJSONWriter) Write(p []byte) (int, error) {
+	// only the lines of the steps, not the summary at the end
+	locations := w.src.locations
+	if !bytes.HasPrefix(p, []byte(`{"pc":`)) || len(locations) == 0 || locations[len(locations)-1] == nil {
+		return w.w.Write(p)
+	}
+
+	line := bytes.TrimRight(p, "\n")
+	if !bytes.HasSuffix(line, []byte("}")) {
+		return w.w.Write(p)
+	}
+	source, _ := json.Marshal(locations[len(locations)-1].String())
+	annotated := make([]byte, 0, len(p)+len(source)+16)
+	annotated = append(annotated, line[:len(line)-1]...)
+	annotated = append(annotated, `,"source":`...)
+	annotated = append(annotated, source...)
+	annotated = append(annotated, "}\n"...)
+	if _, err := w.w.Write(annotated); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeTrace is logger.WriteTrace, with the solidity location of each step written before it,
+// and the console.log lines written after the step that printed them.
+func writeTrace(writer io.Writer, logs []logger.StructLog, locations []*srcmap.Location, console *consoleTracer) {
+	lines := console.printed()
+	for i := range logs {
+		if i < len(locations) && locations[i] != nil {
+			fmt.Fprintf(writer, "@ %s", locations[i])
+			if locations[i].Snippet != "" {
+				fmt.Fprintf(writer, ": %s", locations[i].Snippet)
+			}
+			fmt.Fprintln(writer)
+		}
+		logger.WriteTrace(writer, logs[i:i+1])
+		for len(lines) > 0 && lines[0].step <= i+1 {
+			fmt.Fprintf(writer, "console.log: %s\n", lines[0].text)
+			lines = lines[1:]
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package lab
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/zhiqiangxu/evm-lab/srcmap"
+	"gotest.tools/assert"
+)
+
+func TestSourceTracerFault(t *testing.T) {
+	inner := &srcmap.Location{File: "Vault.sol", Line: 12}
+	outer := &srcmap.Location{File: "Router.sol", Line: 30}
+
+	// the inner revert bubbles up through the outer call
+	tracer := newSourceTracer(newSourceMaps(), false)
+	tracer.setFault(inner, 2)
+	tracer.setFault(outer, 1)
+	assert.Equal(t, tracer.revertLocation(), inner)
+
+	tracer = newSourceTracer(newSourceMaps(), false)
+	tracer.setFault(outer, 1)
+	tracer.setFault(inner, 2)
+	assert.Equal(t, tracer.revertLocation(), inner)
+
+	var none *sourceTracer
+	assert.Assert(t, none.revertLocation() == nil)
+	assert.Assert(t, none.stepLocations() == nil)
+}
+
+func TestSourceTracerSteps(t *testing.T) {
+	// without a trace to annotate, the steps are not recorded
+	tracer := newSourceTracer(newSourceMaps(), false)
+	tracer.CaptureState(0, vm.PUSH1, 0, 0, nil, nil, 1, nil)
+	assert.Equal(t, len(tracer.stepLocations()), 0)
+
+	tracer = newSourceTracer(newSourceMaps(), true)
+	tracer.CaptureState(0, vm.PUSH1, 0, 0, nil, nil, 1, nil)
+	tracer.CaptureState(2, vm.PUSH1, 0, 0, nil, nil, 1, nil)
+	assert.Equal(t, len(tracer.stepLocations()), 2)
+}
+
+func TestSourceJSONWriter(t *testing.T) {
+	var out bytes.Buffer
+	tracer := newSourceTracer(newSourceMaps(), true)
+	w := newSourceJSONWriter(&out, tracer)
+
+	tracer.locations = append(tracer.locations, &srcmap.Location{File: "Token.sol", Line: 42})
+	w.Write([]byte(`{"pc":0,"op":96}` + "\n"))
+	tracer.locations = append(tracer.locations, nil)
+	w.Write([]byte(`{"pc":2,"op":96}` + "\n"))
+	w.Write([]byte(`{"output":"","gasUsed":"0x3"}` + "\n"))
+
+	assert.Equal(t, out.String(), `{"pc":0,"op":96,"source":"Token.sol:42"}`+"\n"+`{"pc":2,"op":96}`+"\n"+`{"output":"","gasUsed":"0x3"}`+"\n")
+	assert.Equal(t, newSourceJSONWriter(&out, nil), &out)
+}
@@ -0,0 +1,166 @@
+package lab
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// newStateDatabase keeps the preimages of the hashed addresses and slots, for the state to be
+// exported with them.
+func newStateDatabase(db ethdb.Database) state.Database {
+	return state.NewDatabaseWithConfig(db, &trie.Config{Preimages: true})
+}
+
+// setAlloc sets the accounts of alloc over statedb.
+func setAlloc(statedb *state.StateDB, alloc core.GenesisAlloc) {
+	for addr, account := range alloc {
+		if account.Balance != nil {
+			statedb.SetBalance(addr, account.Balance)
+		}
+		statedb.SetNonce(addr, account.Nonce)
+		if account.Code != nil {
+			statedb.SetCode(addr, account.Code)
+		}
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+	statedb.Commit(true)
+	statedb.IntermediateRoot(true)
+}
+
+// handleSetState overwrites the account of input, only the fields set are changed.
+func (e *Engine) handleSetState(input SetStateInput) (output SetStateOutput) {
+	state := input.State
+	if state.Balance != nil {
+		if state.Balance.ToInt().Sign() < 0 {
+			output.ErrMsg = "negative balance"
+			return
+		}
+		e.statedb.SetBalance(input.Address, state.Balance.ToInt())
+	}
+	if state.Nonce != nil {
+		e.statedb.SetNonce(input.Address, *state.Nonce)
+	}
+	if state.Code != nil {
+		e.statedb.SetCode(input.Address, state.Code)
+	}
+	for key, value := range state.Storage {
+		e.statedb.SetState(input.Address, key, value)
+	}
+
+	e.statedb.Commit(true)
+	e.statedb.IntermediateRoot(true)
+	return
+}
+
+// handleGetState reads the account of input.
+func (e *Engine) handleGetState(input GetStateInput) (output GetStateOutput) {
+	nonce := e.statedb.GetNonce(input.Address)
+	output.State = AccountState{
+		Balance: (*hexutil.Big)(e.statedb.GetBalance(input.Address)),
+		Nonce:   &nonce,
+		Code:    e.statedb.GetCode(input.Address),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+	for _, key := range input.Storage {
+		output.State.Storage[key] = e.statedb.GetState(input.Address, key)
+	}
+	return
+}
+
+// accountsDump collects the dumped accounts by address. The accounts whose address is unknown,
+// i.e. without preimage, are only counted, since the dump reports them all at the zero address.
+type accountsDump struct {
+	accounts map[common.Address]state.DumpAccount
+	unknown  int
+}
+
+func (d *accountsDump) OnRoot(common.Hash) {}
+
+func (d *accountsDump) OnAccount(addr common.Address, account state.DumpAccount) {
+	if !knownDumpAddress(addr, account) {
+		d.unknown++
+		return
+	}
+	d.accounts[addr] = account
+}
+
+// handleExportState returns the genesis with the current state as its alloc.
+func (e *Engine) handleExportState() (output ExportStateOutput) {
+	if e.conf.Fork != nil && e.conf.Fork.Chaindata != "" {
+		output.ErrMsg = "the state forked from a chaindata can't be exported"
+		return
+	}
+
+	dump := &accountsDump{accounts: make(map[common.Address]state.DumpAccount)}
+	e.statedb.DumpToCollector(dump, &state.DumpConfig{})
+	if dump.unknown > 0 {
+		output.ErrMsg = fmt.Sprintf("the address of %d accounts is unknown", dump.unknown)
+		return
+	}
+
+	alloc := make(core.GenesisAlloc)
+	for addr, account := range dump.accounts {
+		// the cheatcodes are installed at start anyway
+		if e.conf.Cheatcodes && addr == HEVMAddress {
+			continue
+		}
+		balance, ok := new(big.Int).SetString(account.Balance, 10)
+		if !ok {
+			output.ErrMsg = fmt.Sprintf("invalid balance of %s: %s", addr.Hex(), account.Balance)
+			return
+		}
+		genesisAccount := core.GenesisAccount{Balance: balance, Nonce: account.Nonce, Code: account.Code}
+		if len(account.Storage) > 0 {
+			genesisAccount.Storage = make(map[common.Hash]common.Hash, len(account.Storage))
+			for key, value := range account.Storage {
+				genesisAccount.Storage[key] = common.BytesToHash(common.FromHex(value))
+			}
+		}
+		alloc[addr] = genesisAccount
+	}
+
+	genesis := *e.conf.Genesis
+	genesis.Alloc = alloc
+	output.Genesis = &genesis
+	return
+}
+
+// handleImportState replaces the state with the alloc of input.Genesis, whose block fields
+// become the ones of the lab block. The dev accounts of the config are not added, the alloc
+// has them already if they were exported, and the snapshots, coverage and source maps of the
+// replaced state are dropped.
+func (e *Engine) handleImportState(input ImportStateInput) (output ImportStateOutput) {
+	if input.Genesis == nil {
+		output.ErrMsg = "Genesis not specified"
+		return
+	}
+	for addr, account := range input.Genesis.Alloc {
+		if account.Balance != nil && account.Balance.Sign() < 0 {
+			output.ErrMsg = fmt.Sprintf("negative balance of %s", addr.Hex())
+			return
+		}
+	}
+
+	genesis := *input.Genesis
+	e.conf.Genesis = &genesis
+	e.conf.Fork = nil
+	e.conf.DevAccounts = nil
+	e.getHash = nil
+	if err := e.initState(); err != nil {
+		output.ErrMsg = err.Error()
+		return
+	}
+	e.snapshots = newSnapshots()
+	e.coverage = newCoverage()
+	e.sources = newSourceMaps()
+	return
+}
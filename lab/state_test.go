@@ -0,0 +1,79 @@
+package lab
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"gotest.tools/assert"
+)
+
+func TestExportImportState(t *testing.T) {
+	engine := newTestEngine(t)
+	addr := deployCounter(t, engine)
+	assert.Equal(t, callCounter(t, engine, addr), uint64(1))
+	assert.Equal(t, callCounter(t, engine, addr), uint64(2))
+	// the zero address is an account like the others, though the unknown addresses are dumped at it
+	zeroBalance := SetStateInput{State: AccountState{Balance: (*hexutil.Big)(big.NewInt(7))}}
+	assert.Equal(t, engine.SetState(zeroBalance).ErrMsg, "")
+
+	exported := engine.ExportState()
+	assert.Equal(t, exported.ErrMsg, "")
+	account, ok := exported.Genesis.Alloc[addr]
+	assert.Assert(t, ok)
+	assert.Equal(t, hexutil.Encode(account.Code), hexutil.Encode(counterRuntime))
+	assert.Equal(t, account.Storage[common.Hash{}], common.BigToHash(big.NewInt(2)))
+	assert.Equal(t, exported.Genesis.Alloc[testSenderAddr].Nonce, uint64(1))
+
+	other := newTestEngine(t)
+	assert.Equal(t, other.ImportState(ImportStateInput{Genesis: exported.Genesis}).ErrMsg, "")
+
+	assert.Equal(t, exported.Genesis.Alloc[common.Address{}].Balance.String(), "7")
+
+	for _, a := range []common.Address{addr, testSenderAddr, {}} {
+		input := GetStateInput{Address: a, Storage: []common.Hash{{}}}
+		want, got := engine.GetState(input).State, other.GetState(input).State
+		assert.Equal(t, got.Balance.ToInt().String(), want.Balance.ToInt().String())
+		assert.Equal(t, *got.Nonce, *want.Nonce)
+		assert.Equal(t, got.Code.String(), want.Code.String())
+		assert.Equal(t, got.Storage[common.Hash{}], want.Storage[common.Hash{}])
+	}
+	// the imported state goes on where the exported one was
+	assert.Equal(t, callCounter(t, other, addr), uint64(3))
+	assert.Equal(t, callCounter(t, engine, addr), uint64(3))
+}
+
+func TestImportStateDropsSnapshots(t *testing.T) {
+	engine := newTestEngine(t)
+	id := engine.Snapshot()
+	exported := engine.ExportState()
+	assert.Equal(t, exported.ErrMsg, "")
+
+	assert.Equal(t, engine.ImportState(ImportStateInput{Genesis: exported.Genesis}).ErrMsg, "")
+	assert.ErrorContains(t, engine.Revert(id), "not found")
+}
+
+func TestExportStateUnknownAddress(t *testing.T) {
+	// an account committed without its preimage
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.NilError(t, err)
+	statedb.SetBalance(common.HexToAddress("0x70997970c51812dc3a010c7d01b50e0d17dc79c8"), big.NewInt(5))
+	root, err := statedb.Commit(true)
+	assert.NilError(t, err)
+	assert.NilError(t, statedb.Database().TrieDB().Commit(root, false, nil))
+
+	engine := newTestEngine(t)
+	engine.statedb, err = state.New(root, newStateDatabase(db), nil)
+	assert.NilError(t, err)
+	// the accounts set from now on have their preimages
+	setAlloc(engine.statedb, core.GenesisAlloc{testSenderAddr: {Balance: big.NewInt(1)}, {}: {Balance: big.NewInt(2)}})
+
+	exported := engine.ExportState()
+	assert.Equal(t, exported.ErrMsg, "the address of 1 accounts is unknown")
+	assert.Assert(t, exported.Genesis == nil)
+}
@@ -0,0 +1,104 @@
+package lab
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// stateDiffTracer records the accounts and slots touched by a tx, which are then
+// compared between a copy of the state taken before the tx and the state after it.
+type stateDiffTracer struct {
+	pre   *state.StateDB
+	slots map[common.Address]map[common.Hash]struct{}
+}
+
+func newStateDiffTracer(pre *state.StateDB) *stateDiffTracer {
+	return &stateDiffTracer{pre: pre, slots: make(map[common.Address]map[common.Hash]struct{})}
+}
+
+func (t *stateDiffTracer) touch(addr common.Address) map[common.Hash]struct{} {
+	slots, ok := t.slots[addr]
+	if !ok {
+		slots = make(map[common.Hash]struct{})
+		t.slots[addr] = slots
+	}
+	return slots
+}
+
+// diff returns the changes of the touched accounts from the copy to post, nil if nothing changed.
+func (t *stateDiffTracer) diff(post *state.StateDB) *StateDiff {
+	diff := &StateDiff{
+		Pre:  make(map[common.Address]*AccountState),
+		Post: make(map[common.Address]*AccountState),
+	}
+	for addr, slots := range t.slots {
+		var pre, after AccountState
+		changed := false
+
+		if preBalance, postBalance := t.pre.GetBalance(addr), post.GetBalance(addr); preBalance.Cmp(postBalance) != 0 {
+			pre.Balance, after.Balance = (*hexutil.Big)(preBalance), (*hexutil.Big)(postBalance)
+			changed = true
+		}
+		if preNonce, postNonce := t.pre.GetNonce(addr), post.GetNonce(addr); preNonce != postNonce {
+			pre.Nonce, after.Nonce = &preNonce, &postNonce
+			changed = true
+		}
+		if preCode, postCode := t.pre.GetCode(addr), post.GetCode(addr); !bytes.Equal(preCode, postCode) {
+			pre.Code, after.Code = preCode, postCode
+			changed = true
+		}
+		for slot := range slots {
+			preValue, postValue := t.pre.GetState(addr, slot), post.GetState(addr, slot)
+			if preValue == postValue {
+				continue
+			}
+			if pre.Storage == nil {
+				pre.Storage = make(map[common.Hash]common.Hash)
+				after.Storage = make(map[common.Hash]common.Hash)
+			}
+			pre.Storage[slot], after.Storage[slot] = preValue, postValue
+			changed = true
+		}
+
+		if changed {
+			diff.Pre[addr], diff.Post[addr] = &pre, &after
+		}
+	}
+
+	if len(diff.Pre) == 0 {
+		return nil
+	}
+	return diff
+}
+
+func (t *stateDiffTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.touch(from)
+	t.touch(to)
+}
+
+func (t *stateDiffTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if op == vm.SSTORE && len(scope.Stack.Data()) > 0 {
+		t.touch(scope.Contract.Address())[common.Hash(scope.Stack.Back(0).Bytes32())] = struct{}{}
+	}
+}
+
+// CaptureEnter covers the created contracts and the beneficiaries of SELFDESTRUCT as well.
+func (t *stateDiffTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.touch(from)
+	t.touch(to)
+}
+
+func (t *stateDiffTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+}
+
+func (t *stateDiffTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *stateDiffTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+}
@@ -0,0 +1,100 @@
+package lab
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// multiTracer fans the EVM events out to several tracers.
+type multiTracer []vm.EVMLogger
+
+// newMultiTracer combines the non nil tracers, nil is returned if there is none.
+func newMultiTracer(tracers ...vm.EVMLogger) vm.EVMLogger {
+	var t multiTracer
+	for _, tracer := range tracers {
+		if tracer != nil {
+			t = append(t, tracer)
+		}
+	}
+	switch len(t) {
+	case 0:
+		return nil
+	case 1:
+		return t[0]
+	default:
+		return t
+	}
+}
+
+func (t multiTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	for _, tracer := range t {
+		tracer.CaptureStart(env, from, to, create, input, gas, value)
+	}
+}
+
+func (t multiTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	for _, tracer := range t {
+		tracer.CaptureState(pc, op, gas, cost, scope, rData, depth, err)
+	}
+}
+
+func (t multiTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	for _, tracer := range t {
+		tracer.CaptureEnter(typ, from, to, input, gas, value)
+	}
+}
+
+func (t multiTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	for _, tracer := range t {
+		tracer.CaptureExit(output, gasUsed, err)
+	}
+}
+
+func (t multiTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	for _, tracer := range t {
+		tracer.CaptureFault(pc, op, gas, cost, scope, depth, err)
+	}
+}
+
+func (t multiTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	for _, tracer := range t {
+		tracer.CaptureEnd(output, gasUsed, d, err)
+	}
+}
+
+// frame is a call frame as seen by the tracers.
+type frame struct {
+	typ    vm.OpCode
+	from   common.Address
+	to     common.Address
+	create bool
+}
+
+func isCreate(typ vm.OpCode) bool {
+	return typ == vm.CREATE || typ == vm.CREATE2
+}
+
+// codeAddress returns the address the running code belongs to, which differs
+// from the contract address for DELEGATECALL and CALLCODE.
+func codeAddress(scope *vm.ScopeContext) common.Address {
+	if scope.Contract.CodeAddr != nil {
+		return *scope.Contract.CodeAddr
+	}
+	return scope.Contract.Address()
+}
+
+// ParseOp parses an opcode name, case insensitive, like the breakpoints and trace filters take.
+func ParseOp(name string) (vm.OpCode, error) {
+	upper := strings.ToUpper(name)
+	op := vm.StringToOp(upper)
+	// StringToOp returns STOP for unknown names
+	if op == vm.STOP && upper != "STOP" {
+		return 0, fmt.Errorf("unknown opcode %q", name)
+	}
+	return op, nil
+}
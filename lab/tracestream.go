@@ -0,0 +1,185 @@
+package lab
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// streamTracer hands the filtered events to emit as they happen, nothing is buffered.
+// Once emit fails, say the client went away, the execution is cancelled.
+type streamTracer struct {
+	sources   *sourceMaps
+	filter    TraceFilter
+	ops       map[vm.OpCode]bool
+	addresses map[common.Address]bool
+	emit      func(TraceEvent) error
+
+	env    *vm.EVM
+	frames []frame
+	failed bool
+}
+
+func newStreamTracer(sources *sourceMaps, filter TraceFilter, emit func(TraceEvent) error) (*streamTracer, error) {
+	t := &streamTracer{sources: sources, filter: filter, emit: emit}
+	if len(filter.Ops) > 0 {
+		t.ops = make(map[vm.OpCode]bool)
+		for _, name := range filter.Ops {
+			op, err := ParseOp(name)
+			if err != nil {
+				return nil, err
+			}
+			t.ops[op] = true
+		}
+	}
+	if len(filter.Addresses) > 0 {
+		t.addresses = make(map[common.Address]bool)
+		for _, addr := range filter.Addresses {
+			t.addresses[addr] = true
+		}
+	}
+	return t, nil
+}
+
+func (t *streamTracer) send(event TraceEvent) {
+	if t.failed {
+		return
+	}
+	if err := t.emit(event); err != nil {
+		t.failed = true
+		if t.env != nil {
+			t.env.Cancel()
+		}
+	}
+}
+
+func (t *streamTracer) depthMatch(depth int) bool {
+	return (t.filter.MinDepth == 0 || depth >= t.filter.MinDepth) && (t.filter.MaxDepth == 0 || depth <= t.filter.MaxDepth)
+}
+
+func (t *streamTracer) addressMatch(addrs ...common.Address) bool {
+	if t.addresses == nil {
+		return true
+	}
+	for _, addr := range addrs {
+		if t.addresses[addr] {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *streamTracer) enter(f frame, input []byte, gas uint64, value *big.Int) {
+	// console.log lines are reported at the depth of the frame printing them
+	if f.to == ConsoleAddress && t.depthMatch(len(t.frames)) && t.addressMatch(f.from) {
+		line, err := decodeConsoleLog(input)
+		if err != nil {
+			line = err.Error()
+		}
+		t.send(TraceEvent{Console: &TraceConsole{Depth: len(t.frames), Address: f.from, Line: line}})
+	}
+	t.frames = append(t.frames, f)
+	depth := len(t.frames)
+	if !t.depthMatch(depth) || !t.addressMatch(f.to) {
+		return
+	}
+	enter := &TraceEnter{Depth: depth, Type: f.typ.String(), From: f.from, To: f.to, Input: input, Gas: gas}
+	if value != nil {
+		enter.Value = (*hexutil.Big)(value)
+	}
+	t.send(TraceEvent{Enter: enter})
+}
+
+func (t *streamTracer) exit(output []byte, gasUsed uint64, err error) {
+	if len(t.frames) == 0 {
+		return
+	}
+	depth := len(t.frames)
+	f := t.frames[depth-1]
+	t.frames = t.frames[:depth-1]
+	if !t.depthMatch(depth) || !t.addressMatch(f.to) {
+		return
+	}
+	exit := &TraceExit{Depth: depth, Output: output, GasUsed: gasUsed}
+	if err != nil {
+		exit.Error = err.Error()
+	}
+	t.send(TraceEvent{Exit: exit})
+}
+
+func (t *streamTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	t.enter(frame{typ: typ, from: from, to: to, create: create}, input, gas, value)
+}
+
+func (t *streamTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if t.failed || len(t.frames) == 0 {
+		return
+	}
+	if t.ops != nil && !t.ops[op] {
+		return
+	}
+	addr, codeAddr := scope.Contract.Address(), codeAddress(scope)
+	if !t.depthMatch(depth) || !t.addressMatch(addr, codeAddr) {
+		return
+	}
+
+	step := &TraceStep{
+		Depth:    depth,
+		Address:  addr,
+		PC:       pc,
+		Op:       op.String(),
+		Gas:      gas,
+		Cost:     cost,
+		Location: t.sources.location(codeAddr, scope.Contract.Code, t.frames[len(t.frames)-1].create, pc),
+	}
+	if t.filter.Stack {
+		stack := scope.Stack.Data()
+		for i := range stack {
+			step.Stack = append(step.Stack, stack[i].Hex())
+		}
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	t.send(TraceEvent{Step: step})
+}
+
+func (t *streamTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.enter(frame{typ: typ, from: from, to: to, create: isCreate(typ)}, input, gas, value)
+}
+
+func (t *streamTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.exit(output, gasUsed, err)
+}
+
+func (t *streamTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *streamTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	t.exit(output, gasUsed, err)
+}
+
+// handleTrace runs the deploy or call of input on block, statedb and sources, copies of the lab ones,
+// streaming the events through emit, and returns the error of the stream if any.
+func (e *Engine) handleTrace(block blockEnv, statedb *state.StateDB, sources *sourceMaps, input TraceInput, emit func(TraceEvent) error) error {
+	tracer, err := newStreamTracer(sources, input.Filter, emit)
+	if err != nil {
+		return emit(TraceEvent{End: &TraceEnd{ErrMsg: err.Error()}})
+	}
+	execFunc, err := e.prepareTx(block, statedb, sources, input.Deploy, input.Call, tracer)
+	if err != nil {
+		return emit(TraceEvent{End: &TraceEnd{ErrMsg: err.Error()}})
+	}
+
+	r := execFunc()
+	return emit(TraceEvent{End: &TraceEnd{Result: r.result, Addr: r.addr, GasUsed: r.gasUsed, ErrMsg: r.errMsg}})
+}
@@ -16,6 +16,7 @@ func setupAPP() *cli.App {
 	app.Commands = []cli.Command{
 		cmd.ServerCmd,
 		cmd.ClientCmd,
+		cmd.TestCmd,
 	}
 	return app
 }
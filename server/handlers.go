@@ -1,43 +1,188 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"reflect"
 
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/zhiqiangxu/evm-lab/lab"
 )
 
-func (s *Server) deploy(c *gin.Context) {
-	if !s.tmutex.TryLock() {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "no concurrent allowed"})
+var engineType = reflect.TypeOf((*lab.Engine)(nil))
+
+// handle returns the handler of an engine method, like (*lab.Engine).Deploy, which is either a
+// func(*lab.Engine, In) Out or a func(*lab.Engine) Out: In is bound from the request, and the
+// method runs on the engine of the workspace, under its lock.
+func (s *Server) handle(method interface{}) gin.HandlerFunc {
+	fn := reflect.ValueOf(method)
+	typ := fn.Type()
+	if typ.Kind() != reflect.Func || typ.NumIn() < 1 || typ.NumIn() > 2 || typ.In(0) != engineType || typ.NumOut() != 1 {
+		panic(fmt.Sprintf("not an engine method: %v", typ))
+	}
+
+	return func(c *gin.Context) {
+		w := s.workspace(c)
+		if w == nil {
+			return
+		}
+
+		args := []reflect.Value{reflect.ValueOf(w.engine)}
+		if typ.NumIn() == 2 {
+			input := reflect.New(typ.In(1))
+			if err := c.ShouldBind(input.Interface()); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			args = append(args, input.Elem())
+		}
+
+		if !w.tmutex.TryLock() {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "no concurrent allowed"})
+			return
+		}
+		defer w.tmutex.Unlock()
+
+		c.JSON(http.StatusOK, fn.Call(args)[0].Interface())
+	}
+}
+
+func takeSnapshot(engine *lab.Engine) lab.SnapshotOutput {
+	return lab.SnapshotOutput{ID: engine.Snapshot()}
+}
+
+func revertSnapshot(engine *lab.Engine, input lab.RevertInput) (output lab.RevertOutput) {
+	if err := engine.Revert(input.ID); err != nil {
+		output.ErrMsg = err.Error()
+	}
+	return
+}
+
+// debugCommand doesn't take the server lock, since the session runs on its own copy of the state.
+func (s *Server) debugCommand(c *gin.Context) {
+	w := s.workspace(c)
+	if w == nil {
 		return
 	}
-	defer s.tmutex.Unlock()
 
-	var input DeployInput
+	var input lab.DebugCommandInput
 	if err := c.ShouldBind(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
-	output := s.handleDeploy(input)
+	output := w.engine.DebugCommand(input)
 
 	c.JSON(http.StatusOK, output)
 }
 
-func (s *Server) call(c *gin.Context) {
-	if !s.tmutex.TryLock() {
-		c.JSON(http.StatusOK, "no concurrent allowed")
+var upgrader = websocket.Upgrader{}
+
+func (s *Server) debugWS(c *gin.Context) {
+	w := s.workspace(c)
+	if w == nil {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Warn("debug websocket upgrade failed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	var start lab.DebugStartInput
+	if err := conn.ReadJSON(&start); err != nil {
+		return
+	}
+	if !w.tmutex.TryLock() {
+		conn.WriteJSON(gin.H{"message": "no concurrent allowed"})
+		return
+	}
+	output := w.engine.DebugStart(start)
+	w.tmutex.Unlock()
+
+	session := output.Session
+	// the session is stopped when the connection goes away in the middle
+	defer func() {
+		if !output.Done && output.Session != "" {
+			w.engine.DebugCommand(lab.DebugCommandInput{Session: session, Command: lab.DebugStop})
+		}
+	}()
+
+	for {
+		if err := conn.WriteJSON(output); err != nil || output.Done || output.Session == "" {
+			return
+		}
+
+		var input lab.DebugCommandInput
+		if err := conn.ReadJSON(&input); err != nil {
+			return
+		}
+		input.Session = session
+		output = w.engine.DebugCommand(input)
+	}
+}
+
+func (s *Server) trace(c *gin.Context) {
+	w := s.workspace(c)
+	if w == nil {
 		return
 	}
-	defer s.tmutex.Unlock()
 
-	var input CallInput
+	var input lab.TraceInput
 	if err := c.ShouldBind(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
-	output := s.handleCall(input)
+	// the trace runs on a copy of the state, the lock is only checked
+	if !w.tmutex.TryLock() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "no concurrent allowed"})
+		return
+	}
+	w.tmutex.Unlock()
 
-	c.JSON(http.StatusOK, output)
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	w.engine.Trace(input, func(event lab.TraceEvent) error {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+}
+
+func (s *Server) traceWS(c *gin.Context) {
+	w := s.workspace(c)
+	if w == nil {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Warn("trace websocket upgrade failed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	var input lab.TraceInput
+	if err := conn.ReadJSON(&input); err != nil {
+		return
+	}
+
+	if !w.tmutex.TryLock() {
+		conn.WriteJSON(lab.TraceEvent{End: &lab.TraceEnd{ErrMsg: "no concurrent allowed"}})
+		return
+	}
+	w.tmutex.Unlock()
+
+	w.engine.Trace(input, func(event lab.TraceEvent) error {
+		return conn.WriteJSON(event)
+	})
 }
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhiqiangxu/evm-lab/config"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"gotest.tools/assert"
+)
+
+func TestHandle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := New(config.Config{Quiet: true})
+	engine, err := lab.NewEngine(s.conf)
+	assert.NilError(t, err)
+	assert.NilError(t, s.workspaces.add(DefaultWorkspace, engine))
+	r := s.router()
+
+	var snapshot lab.SnapshotOutput
+	assert.Equal(t, post(t, r, SnapshotEndpoint, "", struct{}{}, &snapshot), http.StatusOK)
+	var reverted lab.RevertOutput
+	assert.Equal(t, post(t, r, RevertEndpoint, "", lab.RevertInput{ID: snapshot.ID}, &reverted), http.StatusOK)
+	assert.Equal(t, reverted.ErrMsg, "")
+	assert.Equal(t, post(t, r, RevertEndpoint, "", lab.RevertInput{ID: snapshot.ID + 1}, &reverted), http.StatusOK)
+	assert.Assert(t, reverted.ErrMsg != "")
+
+	// a busy workspace turns the requests down instead of queueing them
+	w := s.workspaces.get(DefaultWorkspace)
+	assert.Assert(t, w.tmutex.TryLock())
+	var busy struct{ Message string }
+	assert.Equal(t, post(t, r, SnapshotEndpoint, "", struct{}{}, &busy), http.StatusBadRequest)
+	assert.Equal(t, busy.Message, "no concurrent allowed")
+	w.tmutex.Unlock()
+
+	assert.Assert(t, func() (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		s.handle(func(input lab.CallInput) lab.CallOutput { return lab.CallOutput{} })
+		return
+	}(), "not an engine method")
+}
@@ -1,38 +1,25 @@
 package server
 
-import (
-	"math/big"
-
-	"github.com/ethereum/go-ethereum/common"
-)
-
-// DeployInput ...
-type DeployInput struct {
-	Sender       common.Address
-	CodeAndInput []byte
-	Gas          uint64
-	GasPrice     *big.Int
-	Value        *big.Int
+// WorkspaceCreateInput creates a workspace from the genesis, or from the state of Source
+type WorkspaceCreateInput struct {
+	Name string
+	// workspace to copy the state of, with the source maps of its contracts
+	Source string
+	// snapshot of Source to copy, its current state if 0
+	Snapshot uint64
 }
 
-// DeployOutput ...
-type DeployOutput struct {
-	Addr   common.Address
-	ErrMsg string
+// WorkspaceDeleteInput ...
+type WorkspaceDeleteInput struct {
+	Name string
 }
 
-// CallInput ...
-type CallInput struct {
-	Input    []byte
-	Gas      uint64
-	Sender   common.Address
-	Receiver common.Address
-	GasPrice *big.Int
-	Value    *big.Int
+// WorkspaceOutput ...
+type WorkspaceOutput struct {
+	ErrMsg string
 }
 
-// CallOutput ...
-type CallOutput struct {
-	Result []byte
-	ErrMsg string
+// WorkspaceListOutput ...
+type WorkspaceListOutput struct {
+	Names []string
 }
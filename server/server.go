@@ -4,14 +4,10 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core"
-	"github.com/ethereum/go-ethereum/core/rawdb"
-	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/gin-gonic/gin"
 	"github.com/zhiqiangxu/evm-lab/config"
-	"github.com/zhiqiangxu/util/mutex"
+	"github.com/zhiqiangxu/evm-lab/lab"
 )
 
 const (
@@ -19,44 +15,75 @@ const (
 	DeployEndpoint = "/deploy"
 	// CallEndpoint ...
 	CallEndpoint = "/call"
+	// StaticCallEndpoint runs a call without keeping its changes, like eth_call
+	StaticCallEndpoint = "/staticCall"
+	// SendRawTransactionEndpoint executes a signed tx with the checks of a node
+	SendRawTransactionEndpoint = "/sendRawTransaction"
+	// AccessListEndpoint ...
+	AccessListEndpoint = "/createAccessList"
+	// EstimateGasEndpoint ...
+	EstimateGasEndpoint = "/estimateGas"
+	// DebugStartEndpoint ...
+	DebugStartEndpoint = "/debug/start"
+	// DebugCommandEndpoint ...
+	DebugCommandEndpoint = "/debug/command"
+	// DebugWSEndpoint serves a debug session over websocket, the first message
+	// is a DebugStartInput, and the following ones are DebugCommandInput.
+	DebugWSEndpoint = "/debug/ws"
+	// TraceEndpoint streams the TraceEvent of a TraceInput as json lines
+	TraceEndpoint = "/trace"
+	// TraceWSEndpoint streams the TraceEvent over websocket, after a TraceInput message
+	TraceWSEndpoint = "/trace/ws"
+	// SnapshotEndpoint saves the lab state
+	SnapshotEndpoint = "/snapshot"
+	// RevertEndpoint restores the lab state saved by SnapshotEndpoint
+	RevertEndpoint = "/revert"
+	// SetStateEndpoint overwrites the balance, nonce, code or storage of an account
+	SetStateEndpoint = "/setState"
+	// GetStateEndpoint returns the balance, nonce, code and storage slots of an account
+	GetStateEndpoint = "/getState"
+	// ChainInfoEndpoint returns the chain ID, the block number and the base fee, for signing txs
+	ChainInfoEndpoint = "/chainInfo"
+	// ExportStateEndpoint returns the genesis with the current state as its alloc
+	ExportStateEndpoint = "/exportState"
+	// ImportStateEndpoint replaces the lab state with the alloc of a genesis
+	ImportStateEndpoint = "/importState"
+	// CoverageEndpoint returns the coverage of the deploys and calls so far
+	CoverageEndpoint = "/coverage"
+	// WorkspaceCreateEndpoint creates a workspace, from the genesis or the state of another one
+	WorkspaceCreateEndpoint = "/workspace/create"
+	// WorkspaceDeleteEndpoint ...
+	WorkspaceDeleteEndpoint = "/workspace/delete"
+	// WorkspaceListEndpoint ...
+	WorkspaceListEndpoint = "/workspace/list"
 )
 
-// Server ...
+// Server exposes the lab.Engine of each workspace over HTTP, rejecting the concurrent
+// requests to the same workspace.
 type Server struct {
-	conf    config.Config
-	tmutex  *mutex.TMutex
-	statedb *state.StateDB
+	conf       config.Config
+	workspaces *workspaces
 }
 
 // New ...
 func New(conf config.Config) *Server {
-	return &Server{tmutex: mutex.New(), conf: conf}
+	return &Server{
+		conf:       conf,
+		workspaces: newWorkspaces(),
+	}
 }
 
 // Start ...
 func (s *Server) Start() (err error) {
-	err = s.initState()
+	engine, err := lab.NewEngine(s.conf)
 	if err != nil {
 		return
 	}
+	s.workspaces.add(DefaultWorkspace, engine)
 	err = s.startHTTP()
 	return
 }
 
-func (s *Server) initState() (err error) {
-
-	db := rawdb.NewMemoryDatabase()
-	if s.conf.Genesis != nil {
-		genesis := s.conf.Genesis.ToBlock(db)
-		s.statedb, _ = state.New(genesis.Root(), state.NewDatabase(db), nil)
-	} else {
-		s.statedb, _ = state.New(common.Hash{}, state.NewDatabase(db), nil)
-		s.conf.Genesis = &core.Genesis{}
-	}
-
-	return
-}
-
 func (s *Server) initLogger() {
 	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
 	glogger.Verbosity(log.Lvl(s.conf.Verbosity))
@@ -64,11 +91,43 @@ func (s *Server) initLogger() {
 }
 
 func (s *Server) startHTTP() error {
+	return s.router().Run(fmt.Sprintf(":%d", s.conf.Port))
+}
+
+// router routes the endpoints of the workspaces, and the ones managing them.
+func (s *Server) router() *gin.Engine {
 	r := gin.Default()
 
-	r.POST(DeployEndpoint, s.deploy)
-	r.POST(CallEndpoint, s.call)
+	// the workspace is picked by the path prefix, or else by WorkspaceHeader
+	s.route(r.Group(""))
+	s.route(r.Group(WorkspacePathPrefix + "/:workspace"))
 
-	return r.Run(fmt.Sprintf(":%d", s.conf.Port))
+	r.POST(WorkspaceCreateEndpoint, s.createWorkspace)
+	r.POST(WorkspaceDeleteEndpoint, s.deleteWorkspace)
+	r.POST(WorkspaceListEndpoint, s.listWorkspaces)
+
+	return r
+}
 
+// route registers the endpoints of a workspace in g.
+func (s *Server) route(g *gin.RouterGroup) {
+	g.POST(DeployEndpoint, s.handle((*lab.Engine).Deploy))
+	g.POST(CallEndpoint, s.handle((*lab.Engine).Call))
+	g.POST(StaticCallEndpoint, s.handle((*lab.Engine).StaticCall))
+	g.POST(AccessListEndpoint, s.handle((*lab.Engine).CreateAccessList))
+	g.POST(EstimateGasEndpoint, s.handle((*lab.Engine).EstimateGas))
+	g.POST(DebugStartEndpoint, s.handle((*lab.Engine).DebugStart))
+	g.POST(DebugCommandEndpoint, s.debugCommand)
+	g.GET(DebugWSEndpoint, s.debugWS)
+	g.POST(TraceEndpoint, s.trace)
+	g.GET(TraceWSEndpoint, s.traceWS)
+	g.POST(SnapshotEndpoint, s.handle(takeSnapshot))
+	g.POST(RevertEndpoint, s.handle(revertSnapshot))
+	g.POST(SetStateEndpoint, s.handle((*lab.Engine).SetState))
+	g.POST(GetStateEndpoint, s.handle((*lab.Engine).GetState))
+	g.POST(SendRawTransactionEndpoint, s.handle((*lab.Engine).SendRawTransaction))
+	g.POST(ChainInfoEndpoint, s.handle((*lab.Engine).ChainInfo))
+	g.POST(ExportStateEndpoint, s.handle((*lab.Engine).ExportState))
+	g.POST(ImportStateEndpoint, s.handle((*lab.Engine).ImportState))
+	g.POST(CoverageEndpoint, s.handle((*lab.Engine).Coverage))
 }
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"github.com/zhiqiangxu/util/mutex"
+)
+
+const (
+	// DefaultWorkspace is the workspace of the requests which don't pick one
+	DefaultWorkspace = "default"
+	// WorkspaceHeader picks the workspace of a request
+	WorkspaceHeader = "X-Workspace"
+	// WorkspacePathPrefix followed by the name picks the workspace of a request,
+	// e.g. /w/alice/deploy
+	WorkspacePathPrefix = "/w"
+)
+
+var workspaceNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// workspace is an isolated lab state, requests to different workspaces don't wait for each other.
+type workspace struct {
+	tmutex *mutex.TMutex
+	engine *lab.Engine
+}
+
+type workspaces struct {
+	sync.Mutex
+	byName map[string]*workspace
+}
+
+func newWorkspaces() *workspaces {
+	return &workspaces{byName: make(map[string]*workspace)}
+}
+
+func (ws *workspaces) add(name string, engine *lab.Engine) error {
+	ws.Lock()
+	defer ws.Unlock()
+	if ws.byName[name] != nil {
+		return fmt.Errorf("workspace %q already exists", name)
+	}
+	ws.byName[name] = &workspace{tmutex: mutex.New(), engine: engine}
+	return nil
+}
+
+func (ws *workspaces) get(name string) *workspace {
+	ws.Lock()
+	defer ws.Unlock()
+	return ws.byName[name]
+}
+
+func (ws *workspaces) remove(name string) bool {
+	ws.Lock()
+	defer ws.Unlock()
+	if ws.byName[name] == nil {
+		return false
+	}
+	delete(ws.byName, name)
+	return true
+}
+
+func (ws *workspaces) names() (names []string) {
+	ws.Lock()
+	defer ws.Unlock()
+	for name := range ws.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// workspace returns the workspace picked by the request, or responds with an error and returns nil.
+func (s *Server) workspace(c *gin.Context) *workspace {
+	name := c.Param("workspace")
+	if name == "" {
+		name = c.GetHeader(WorkspaceHeader)
+	}
+	if name == "" {
+		name = DefaultWorkspace
+	}
+
+	w := s.workspaces.get(name)
+	if w == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("workspace %q not found", name)})
+	}
+	return w
+}
+
+func (s *Server) handleCreateWorkspace(input WorkspaceCreateInput) (output WorkspaceOutput) {
+	if !workspaceNameRegexp.MatchString(input.Name) {
+		output.ErrMsg = fmt.Sprintf("invalid workspace name %q", input.Name)
+		return
+	}
+
+	var (
+		engine *lab.Engine
+		err    error
+	)
+	if input.Source == "" {
+		if input.Snapshot != 0 {
+			output.ErrMsg = "a snapshot is taken from a source workspace"
+			return
+		}
+		engine, err = lab.NewEngine(s.conf)
+	} else {
+		source := s.workspaces.get(input.Source)
+		if source == nil {
+			output.ErrMsg = fmt.Sprintf("workspace %q not found", input.Source)
+			return
+		}
+		engine, err = source.engine.Fork(input.Snapshot)
+	}
+	if err == nil {
+		err = s.workspaces.add(input.Name, engine)
+	}
+	if err != nil {
+		output.ErrMsg = err.Error()
+	}
+	return
+}
+
+func (s *Server) handleDeleteWorkspace(input WorkspaceDeleteInput) (output WorkspaceOutput) {
+	if input.Name == DefaultWorkspace {
+		output.ErrMsg = "the default workspace can't be deleted"
+		return
+	}
+	if !s.workspaces.remove(input.Name) {
+		output.ErrMsg = fmt.Sprintf("workspace %q not found", input.Name)
+	}
+	return
+}
+
+func (s *Server) createWorkspace(c *gin.Context) {
+	var input WorkspaceCreateInput
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	output := s.handleCreateWorkspace(input)
+
+	c.JSON(http.StatusOK, output)
+}
+
+func (s *Server) deleteWorkspace(c *gin.Context) {
+	var input WorkspaceDeleteInput
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	output := s.handleDeleteWorkspace(input)
+
+	c.JSON(http.StatusOK, output)
+}
+
+func (s *Server) listWorkspaces(c *gin.Context) {
+	c.JSON(http.StatusOK, WorkspaceListOutput{Names: s.workspaces.names()})
+}
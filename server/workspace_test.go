@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+	"github.com/zhiqiangxu/evm-lab/config"
+	"github.com/zhiqiangxu/evm-lab/lab"
+	"gotest.tools/assert"
+)
+
+// post sends input to path of r, with the workspace header if not empty, and decodes the response into output.
+func post(t *testing.T, r *gin.Engine, path, workspace string, input, output interface{}) int {
+	t.Helper()
+	body, err := json.Marshal(input)
+	assert.NilError(t, err)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if workspace != "" {
+		req.Header.Set(WorkspaceHeader, workspace)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if output != nil {
+		assert.NilError(t, json.Unmarshal(w.Body.Bytes(), output), w.Body.String())
+	}
+	return w.Code
+}
+
+func TestWorkspaces(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := New(config.Config{Quiet: true})
+	engine, err := lab.NewEngine(s.conf)
+	assert.NilError(t, err)
+	assert.NilError(t, s.workspaces.add(DefaultWorkspace, engine))
+	r := s.router()
+
+	create := func(input WorkspaceCreateInput) {
+		var output WorkspaceOutput
+		assert.Equal(t, post(t, r, WorkspaceCreateEndpoint, "", input, &output), http.StatusOK)
+		assert.Equal(t, output.ErrMsg, "")
+	}
+	addr := common.HexToAddress("0x5fbdb2315678afecb367f032d93f642f64180aa3")
+	setBalance := func(path string, balance int64) {
+		var output lab.SetStateOutput
+		input := lab.SetStateInput{Address: addr, State: lab.AccountState{Balance: (*hexutil.Big)(big.NewInt(balance))}}
+		assert.Equal(t, post(t, r, path, "", input, &output), http.StatusOK)
+		assert.Equal(t, output.ErrMsg, "")
+	}
+	balance := func(workspace string) int64 {
+		var output lab.GetStateOutput
+		assert.Equal(t, post(t, r, GetStateEndpoint, workspace, lab.GetStateInput{Address: addr}, &output), http.StatusOK)
+		return output.State.Balance.ToInt().Int64()
+	}
+
+	create(WorkspaceCreateInput{Name: "a"})
+	create(WorkspaceCreateInput{Name: "b"})
+
+	// picked by the path prefix, the change is only seen in its workspace
+	setBalance(WorkspacePathPrefix+"/a"+SetStateEndpoint, 7)
+	assert.Equal(t, balance("a"), int64(7))
+	assert.Equal(t, balance("b"), int64(0))
+	assert.Equal(t, balance(""), int64(0))
+
+	// a workspace forked from a snapshot has the state of the snapshot, and goes its own way
+	var snapshot lab.SnapshotOutput
+	assert.Equal(t, post(t, r, WorkspacePathPrefix+"/a"+SnapshotEndpoint, "", struct{}{}, &snapshot), http.StatusOK)
+	setBalance(WorkspacePathPrefix+"/a"+SetStateEndpoint, 8)
+	create(WorkspaceCreateInput{Name: "c", Source: "a", Snapshot: snapshot.ID})
+	assert.Equal(t, balance("c"), int64(7))
+	setBalance(WorkspacePathPrefix+"/c"+SetStateEndpoint, 9)
+	assert.Equal(t, balance("a"), int64(8))
+	assert.Equal(t, balance("c"), int64(9))
+
+	var list WorkspaceListOutput
+	post(t, r, WorkspaceListEndpoint, "", struct{}{}, &list)
+	assert.DeepEqual(t, list.Names, []string{"a", "b", "c", DefaultWorkspace})
+
+	var deleted WorkspaceOutput
+	post(t, r, WorkspaceDeleteEndpoint, "", WorkspaceDeleteInput{Name: "b"}, &deleted)
+	assert.Equal(t, deleted.ErrMsg, "")
+	assert.Equal(t, post(t, r, GetStateEndpoint, "b", lab.GetStateInput{Address: addr}, nil), http.StatusNotFound)
+}
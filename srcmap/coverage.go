@@ -0,0 +1,84 @@
+package srcmap
+
+import (
+	"fmt"
+	"sort"
+)
+
+// opcode of JUMPI, the instruction behind the branches
+const jumpi = 0x57
+
+// FileCoverage is the line and branch coverage of a solidity file.
+type FileCoverage struct {
+	File    string
+	Content string
+	// execution count by line, for the lines with code
+	Lines map[int]uint64
+	// the JUMPIs of the file, in the order of the code
+	Branches []*Branch
+
+	branchIndexes map[string]int
+}
+
+// Branch is a JUMPI, with the number of times it jumped and didn't.
+type Branch struct {
+	Line     int
+	Taken    uint64
+	NotTaken uint64
+}
+
+// Cover adds the coverage of the code of m to files, by file name. hits are the executions
+// by pc, and jumps the number of times the JUMPI at pc jumped and didn't.
+func (m *Mapper) Cover(files map[string]*FileCoverage, hits map[uint64]uint64, jumps map[uint64][2]uint64) {
+	pcs := make([]uint64, 0, len(m.indexes))
+	for pc := range m.indexes {
+		pcs = append(pcs, pc)
+	}
+	sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+
+	// the line counts of this code, a line is executed as many times as its most executed instruction
+	lines := make(map[string]map[int]uint64)
+	// JUMPIs generated from the same source range are told apart by their order
+	occurrences := make(map[string]int)
+	for _, pc := range pcs {
+		entry, ok := m.Entry(pc)
+		if !ok || entry.File < 0 || entry.File >= len(m.sources) {
+			continue
+		}
+		src := m.sources[entry.File]
+		file := files[src.Name]
+		if file == nil {
+			file = &FileCoverage{File: src.Name, Content: src.Content, Lines: make(map[int]uint64), branchIndexes: make(map[string]int)}
+			files[src.Name] = file
+		}
+		if lines[src.Name] == nil {
+			lines[src.Name] = make(map[int]uint64)
+		}
+
+		line := src.line(entry.Start)
+		if count, ok := lines[src.Name][line]; !ok || hits[pc] > count {
+			lines[src.Name][line] = hits[pc]
+		}
+
+		if m.code[pc] != jumpi {
+			continue
+		}
+		site := fmt.Sprintf("%d:%d", entry.Start, entry.Length)
+		key := fmt.Sprintf("%s:%d", site, occurrences[site])
+		occurrences[site]++
+		index, ok := file.branchIndexes[key]
+		if !ok {
+			index = len(file.Branches)
+			file.branchIndexes[key] = index
+			file.Branches = append(file.Branches, &Branch{Line: line})
+		}
+		file.Branches[index].Taken += jumps[pc][0]
+		file.Branches[index].NotTaken += jumps[pc][1]
+	}
+
+	for name, counts := range lines {
+		for line, count := range counts {
+			files[name].Lines[line] += count
+		}
+	}
+}
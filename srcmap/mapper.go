@@ -0,0 +1,237 @@
+package srcmap
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Source is a solidity source file, as listed in the sourceList of solc.
+type Source struct {
+	Name    string
+	Content string
+}
+
+// Artifact is what it takes to map the code of a deployed contract back to solidity.
+type Artifact struct {
+	Name          string
+	SrcMap        string
+	SrcMapRuntime string
+	// indexed by the file index of the source maps
+	Sources []Source
+}
+
+// Location is the solidity source an instruction was generated from.
+type Location struct {
+	File     string
+	Line     int
+	Function string `json:",omitempty"`
+	Snippet  string `json:",omitempty"`
+}
+
+func (l *Location) String() string {
+	if l.Function == "" {
+		return fmt.Sprintf("%s:%d", l.File, l.Line)
+	}
+	return fmt.Sprintf("%s:%d (%s)", l.File, l.Line, l.Function)
+}
+
+// Mapper resolves the pcs of some code to solidity locations.
+type Mapper struct {
+	code      []byte
+	indexes   map[uint64]int
+	entries   []Entry
+	sources   []*source
+	locations map[uint64]*Location
+}
+
+// NewMapper creates a Mapper for code, srcMap should be SrcMap for creation code and SrcMapRuntime for runtime code.
+func NewMapper(code []byte, srcMap string, sources []Source) *Mapper {
+	m := &Mapper{
+		code:      code,
+		indexes:   InstructionIndexes(code),
+		entries:   Parse(srcMap),
+		locations: make(map[uint64]*Location),
+	}
+	for _, s := range sources {
+		m.sources = append(m.sources, newSource(s))
+	}
+	return m
+}
+
+// Entry returns the source map entry of the instruction at pc.
+func (m *Mapper) Entry(pc uint64) (entry Entry, ok bool) {
+	index, ok := m.indexes[pc]
+	if !ok || index >= len(m.entries) {
+		return Entry{}, false
+	}
+	return m.entries[index], true
+}
+
+// Location returns the location of the instruction at pc, nil if it's compiler generated.
+func (m *Mapper) Location(pc uint64) *Location {
+	if location, ok := m.locations[pc]; ok {
+		return location
+	}
+
+	var location *Location
+	entry, ok := m.Entry(pc)
+	if ok && entry.File >= 0 && entry.File < len(m.sources) {
+		location = m.sources[entry.File].location(entry.Start, entry.Length)
+	}
+	m.locations[pc] = location
+	return location
+}
+
+type span struct {
+	name       string
+	start, end int
+}
+
+type source struct {
+	Source
+	lineStarts []int
+	contracts  []span
+	functions  []span
+}
+
+func newSource(s Source) *source {
+	src := &source{Source: s, lineStarts: []int{0}}
+	for i := 0; i < len(s.Content); i++ {
+		if s.Content[i] == '\n' {
+			src.lineStarts = append(src.lineStarts, i+1)
+		}
+	}
+	src.contracts = findSpans(s.Content, contractRegexp)
+	src.functions = findSpans(s.Content, functionRegexp)
+	return src
+}
+
+// line returns the 1 based line number of offset.
+func (s *source) line(offset int) int {
+	return sort.Search(len(s.lineStarts), func(i int) bool { return s.lineStarts[i] > offset })
+}
+
+func (s *source) location(start, length int) *Location {
+	location := &Location{File: s.Name, Line: s.line(start)}
+
+	// the innermost function containing the whole range
+	var function *span
+	for i := range s.functions {
+		f := &s.functions[i]
+		if f.start <= start && start+length <= f.end && (function == nil || f.start >= function.start) {
+			function = f
+		}
+	}
+	if function != nil {
+		location.Function = function.name
+		for _, c := range s.contracts {
+			if c.start <= function.start && function.end <= c.end {
+				location.Function = c.name + "." + function.name
+				break
+			}
+		}
+	}
+
+	if start < len(s.Content) {
+		end := start + length
+		if end > len(s.Content) {
+			end = len(s.Content)
+		}
+		snippet := s.Content[start:end]
+		if i := strings.IndexByte(snippet, '\n'); i >= 0 {
+			snippet = snippet[:i] + " ..."
+		}
+		snippet = strings.TrimSpace(snippet)
+		if len(snippet) > maxSnippet {
+			snippet = snippet[:maxSnippet] + " ..."
+		}
+		location.Snippet = snippet
+	}
+	return location
+}
+
+const maxSnippet = 80
+
+var (
+	contractRegexp = regexp.MustCompile(`\b(?:contract|library|interface)\s+([A-Za-z_$][A-Za-z0-9_$]*)`)
+	functionRegexp = regexp.MustCompile(`\b(?:function\s+([A-Za-z_$][A-Za-z0-9_$]*)|(constructor|fallback|receive)|modifier\s+([A-Za-z_$][A-Za-z0-9_$]*))\s*\(`)
+)
+
+// findSpans finds the definitions matched by re, and the range of their bodies.
+// Definitions without a body, like interface functions, are skipped.
+func findSpans(content string, re *regexp.Regexp) (spans []span) {
+	for _, match := range re.FindAllStringSubmatchIndex(content, -1) {
+		var name string
+		for i := 2; i+1 < len(match); i += 2 {
+			if match[i] >= 0 {
+				name = content[match[i]:match[i+1]]
+				break
+			}
+		}
+
+		// the body starts with the first { outside of parentheses
+		depth, bodyStart := 0, -1
+	header:
+		for i := match[1]; i < len(content); i++ {
+			switch content[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			case '{':
+				if depth <= 0 {
+					bodyStart = i
+					break header
+				}
+			case ';':
+				if depth <= 0 {
+					break header
+				}
+			}
+		}
+		if bodyStart < 0 {
+			continue
+		}
+
+		spans = append(spans, span{name: name, start: match[0], end: matchBrace(content, bodyStart)})
+	}
+	return
+}
+
+// matchBrace returns the offset just after the brace closing the one at start,
+// skipping comments and string literals.
+func matchBrace(content string, start int) int {
+	depth := 0
+	for i := start; i < len(content); i++ {
+		switch c := content[i]; c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '/':
+			if i+1 < len(content) && content[i+1] == '/' {
+				for i < len(content) && content[i] != '\n' {
+					i++
+				}
+			} else if i+1 < len(content) && content[i+1] == '*' {
+				end := strings.Index(content[i+2:], "*/")
+				if end < 0 {
+					return len(content)
+				}
+				i += end + 3
+			}
+		case '"', '\'':
+			for i++; i < len(content) && content[i] != c; i++ {
+				if content[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return len(content)
+}
@@ -0,0 +1,67 @@
+package srcmap
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Entry is one decompressed item of a solc source map, see
+// https://docs.soliditylang.org/en/latest/internals/source_mappings.html
+type Entry struct {
+	Start         int
+	Length        int
+	File          int // -1 when the instruction is not associated with any source file
+	Jump          byte
+	ModifierDepth int
+}
+
+// Parse decompresses a source map, with one entry per instruction.
+func Parse(srcMap string) []Entry {
+	if srcMap == "" {
+		return nil
+	}
+
+	var (
+		entries []Entry
+		last    = Entry{File: -1, Jump: '-'}
+	)
+	for _, item := range strings.Split(srcMap, ";") {
+		entry := last
+		for i, field := range strings.Split(item, ":") {
+			if field == "" {
+				continue
+			}
+			switch i {
+			case 0:
+				entry.Start, _ = strconv.Atoi(field)
+			case 1:
+				entry.Length, _ = strconv.Atoi(field)
+			case 2:
+				entry.File, _ = strconv.Atoi(field)
+			case 3:
+				entry.Jump = field[0]
+			case 4:
+				entry.ModifierDepth, _ = strconv.Atoi(field)
+			}
+		}
+		entries = append(entries, entry)
+		last = entry
+	}
+	return entries
+}
+
+// InstructionIndexes maps the pc of every instruction in code to its index,
+// which is what the entries of a source map are indexed by.
+func InstructionIndexes(code []byte) map[uint64]int {
+	indexes := make(map[uint64]int)
+	for pc, index := 0, 0; pc < len(code); index++ {
+		indexes[uint64(pc)] = index
+		op := code[pc]
+		pc++
+		// PUSH1 ~ PUSH32
+		if op >= 0x60 && op <= 0x7f {
+			pc += int(op - 0x5f)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,71 @@
+package srcmap
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParse(t *testing.T) {
+	entries := Parse("1:2:1;:9;2:1:2;;")
+
+	assert.DeepEqual(t, entries, []Entry{
+		{Start: 1, Length: 2, File: 1, Jump: '-'},
+		{Start: 1, Length: 9, File: 1, Jump: '-'},
+		{Start: 2, Length: 1, File: 2, Jump: '-'},
+		{Start: 2, Length: 1, File: 2, Jump: '-'},
+		{Start: 2, Length: 1, File: 2, Jump: '-'},
+	})
+}
+
+func TestInstructionIndexes(t *testing.T) {
+	// PUSH1 0x80 PUSH2 0x0102 ADD STOP
+	indexes := InstructionIndexes([]byte{0x60, 0x80, 0x61, 0x01, 0x02, 0x01, 0x00})
+
+	assert.DeepEqual(t, indexes, map[uint64]int{0: 0, 2: 1, 5: 2, 6: 3})
+}
+
+const testSource = `pragma solidity ^0.8.0;
+
+contract Test {
+    uint x;
+
+    function set(uint v) public returns (uint) {
+        require(v != 0, "zero {");
+        x = v;
+        return x;
+    }
+}
+`
+
+func TestLocation(t *testing.T) {
+	require := `require(v != 0, "zero {")`
+	m := NewMapper([]byte{0x00}, "0:1:0", []Source{{Name: "Test.sol", Content: testSource}})
+	m.entries[0] = Entry{Start: strings.Index(testSource, require), Length: len(require), File: 0}
+
+	location := m.Location(0)
+	assert.Equal(t, location.File, "Test.sol")
+	assert.Equal(t, location.Line, 7)
+	assert.Equal(t, location.Function, "Test.set")
+	assert.Equal(t, location.Snippet, require)
+}
+
+func TestCover(t *testing.T) {
+	// PUSH1 0x01 PUSH1 0x08 JUMPI STOP JUMPDEST STOP
+	code := []byte{0x60, 0x01, 0x60, 0x08, 0x57, 0x00, 0x5b, 0x00}
+	m := NewMapper(code, "0:1:0;;2:1:0;4:1:0;;::-1", []Source{{Name: "Test.sol", Content: "a\nb\nc\n"}})
+
+	files := make(map[string]*FileCoverage)
+	m.Cover(files, map[uint64]uint64{0: 2, 2: 2, 4: 2, 5: 1, 6: 1, 7: 1}, map[uint64][2]uint64{4: {1, 1}})
+	file := files["Test.sol"]
+	assert.DeepEqual(t, file.Lines, map[int]uint64{1: 2, 2: 2, 3: 1})
+	assert.Equal(t, len(file.Branches), 1)
+	assert.DeepEqual(t, *file.Branches[0], Branch{Line: 2, Taken: 1, NotTaken: 1})
+
+	// the same code deployed twice adds up
+	m.Cover(files, map[uint64]uint64{0: 1, 2: 1, 4: 1, 5: 1}, map[uint64][2]uint64{4: {0, 1}})
+	assert.DeepEqual(t, file.Lines, map[int]uint64{1: 3, 2: 3, 3: 2})
+	assert.Equal(t, len(file.Branches), 1)
+	assert.DeepEqual(t, *file.Branches[0], Branch{Line: 2, Taken: 1, NotTaken: 2})
+}
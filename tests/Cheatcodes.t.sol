@@ -0,0 +1,75 @@
+pragma solidity ^0.5.15;
+
+interface Hevm {
+    function warp(uint256) external;
+    function roll(uint256) external;
+    function deal(address, uint256) external;
+    function prank(address) external;
+    function store(address, bytes32, bytes32) external;
+    function load(address, bytes32) external returns (bytes32);
+    function expectRevert(bytes calldata) external;
+    function expectEmit(bool, bool, bool, bool) external;
+}
+
+contract Vault {
+    event Deposit(address indexed owner, uint256 amount);
+
+    address public owner;
+    mapping(address => uint256) public balances;
+
+    constructor() public {
+        owner = msg.sender;
+    }
+
+    function deposit() public payable {
+        balances[msg.sender] += msg.value;
+        emit Deposit(msg.sender, msg.value);
+    }
+
+    function sweep() public {
+        require(msg.sender == owner, "not owner");
+        msg.sender.transfer(address(this).balance);
+    }
+}
+
+contract CheatcodesTest {
+    event Deposit(address indexed owner, uint256 amount);
+
+    Hevm constant hevm = Hevm(0x7109709ECfa91a80626fF3989D68f67F5b1DD12D);
+    Vault vault;
+
+    function setUp() public {
+        vault = new Vault();
+    }
+
+    function testWarpAndRoll() public {
+        hevm.warp(1000);
+        hevm.roll(42);
+        require(block.timestamp == 1000, "warp");
+        require(block.number == 42, "roll");
+    }
+
+    function testDeal() public {
+        hevm.deal(address(this), 1 ether);
+        require(address(this).balance == 1 ether, "deal");
+    }
+
+    function testStoreAndLoad() public {
+        hevm.store(address(vault), bytes32(0), bytes32(uint256(address(this))));
+        require(vault.owner() == address(this), "store");
+        require(hevm.load(address(vault), bytes32(0)) == bytes32(uint256(address(this))), "load");
+    }
+
+    function testPrankedSweepReverts() public {
+        hevm.prank(address(0xbeef));
+        hevm.expectRevert(abi.encodeWithSignature("Error(string)", "not owner"));
+        vault.sweep();
+    }
+
+    function testExpectEmit() public {
+        hevm.deal(address(this), 1 ether);
+        hevm.expectEmit(true, false, false, true);
+        emit Deposit(address(this), 1 ether);
+        vault.deposit.value(1 ether)();
+    }
+}
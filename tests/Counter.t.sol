@@ -0,0 +1,31 @@
+pragma solidity ^0.5.15;
+
+contract Counter {
+    uint256 public count;
+
+    function increment() public {
+        count += 1;
+    }
+
+    function decrement() public {
+        require(count > 0, "count is zero");
+        count -= 1;
+    }
+}
+
+contract CounterTest {
+    Counter counter;
+
+    function setUp() public {
+        counter = new Counter();
+    }
+
+    function testIncrement() public {
+        counter.increment();
+        require(counter.count() == 1, "count should be 1");
+    }
+
+    function testFailDecrementBelowZero() public {
+        counter.decrement();
+    }
+}
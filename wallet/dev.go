@@ -0,0 +1,48 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/zhiqiangxu/evm-lab/config"
+)
+
+const defaultDevCount = 10
+
+// DevKeys returns the keys of the dev accounts, in order.
+func DevKeys(dev *config.DevAccounts) ([]*ecdsa.PrivateKey, error) {
+	path := DefaultHDPath
+	if dev.HDPath != "" {
+		var err error
+		if path, err = accounts.ParseDerivationPath(dev.HDPath); err != nil {
+			return nil, err
+		}
+	}
+	count := dev.Count
+	if count == 0 {
+		count = defaultDevCount
+	}
+	return DeriveKeys(dev.Mnemonic, "", path, count)
+}
+
+// DevAlloc funds the dev accounts.
+func DevAlloc(dev *config.DevAccounts) (core.GenesisAlloc, error) {
+	keys, err := DevKeys(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := new(big.Int).Mul(big.NewInt(10000), big.NewInt(params.Ether))
+	if dev.Balance != nil {
+		balance = (*big.Int)(dev.Balance)
+	}
+	alloc := make(core.GenesisAlloc, len(keys))
+	for _, key := range keys {
+		alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: new(big.Int).Set(balance)}
+	}
+	return alloc, nil
+}
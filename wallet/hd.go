@@ -0,0 +1,100 @@
+// Package wallet derives the accounts of BIP-39 mnemonics along BIP-32 paths, like the HD
+// wallets do, for the keystore of the client and the dev accounts of the genesis.
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// DefaultHDPath is the path of the first account of a mnemonic, m/44'/60'/0'/0/0, the
+// following ones incrementing its last component.
+var DefaultHDPath = accounts.DefaultBaseDerivationPath
+
+const hardened = 0x80000000
+
+// NewMnemonic returns a random mnemonic of 12 words.
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(128)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// DeriveKeys returns count keys of mnemonic from path on, incrementing its last component.
+func DeriveKeys(mnemonic, passphrase string, path accounts.DerivationPath, count int) (keys []*ecdsa.PrivateKey, err error) {
+	if len(path) == 0 {
+		return nil, errors.New("empty derivation path")
+	}
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic: %v", err)
+	}
+
+	path = append(accounts.DerivationPath{}, path...)
+	for i := 0; i < count; i++ {
+		var key *ecdsa.PrivateKey
+		key, err = deriveKey(seed, path)
+		if err != nil {
+			return
+		}
+		keys = append(keys, key)
+		path[len(path)-1]++
+	}
+	return
+}
+
+// deriveKey is the private key derivation of BIP-32.
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	sum := hmacSHA512([]byte("Bitcoin seed"), seed)
+	key, chainCode := new(big.Int).SetBytes(sum[:32]), sum[32:]
+	n := crypto.S256().Params().N
+	if key.Sign() == 0 || key.Cmp(n) >= 0 {
+		return nil, errors.New("invalid seed")
+	}
+
+	for _, index := range path {
+		var data []byte
+		if index >= hardened {
+			data = append([]byte{0}, math.PaddedBigBytes(key, 32)...)
+		} else {
+			parent, err := crypto.ToECDSA(math.PaddedBigBytes(key, 32))
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&parent.PublicKey)
+		}
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+		sum = hmacSHA512(chainCode, data)
+		child := new(big.Int).SetBytes(sum[:32])
+		// as unlikely as it gets, the next index should be used then
+		if child.Cmp(n) >= 0 {
+			return nil, fmt.Errorf("invalid key at %s, use the next index", path)
+		}
+		key = child.Add(child, key).Mod(child, n)
+		if key.Sign() == 0 {
+			return nil, fmt.Errorf("invalid key at %s, use the next index", path)
+		}
+		chainCode = sum[32:]
+	}
+	return crypto.ToECDSA(math.PaddedBigBytes(key, 32))
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,39 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gotest.tools/assert"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// test vector 1 of BIP-32
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	cases := []struct {
+		path accounts.DerivationPath
+		key  string
+	}{
+		{nil, "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{accounts.DerivationPath{hardened}, "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{accounts.DerivationPath{hardened, 1}, "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+	}
+	for _, c := range cases {
+		key, err := deriveKey(seed, c.path)
+		assert.NilError(t, err)
+		assert.Equal(t, hex.EncodeToString(crypto.FromECDSA(key)), c.key)
+	}
+}
+
+func TestDeriveKeys(t *testing.T) {
+	keys, err := DeriveKeys("test test test test test test test test test test test junk", "", DefaultHDPath, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(keys), 2)
+	assert.Equal(t, crypto.PubkeyToAddress(keys[0].PublicKey).Hex(), "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")
+	assert.Equal(t, hex.EncodeToString(crypto.FromECDSA(keys[1])), "59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d")
+
+	_, err = DeriveKeys("test test test", "", DefaultHDPath, 1)
+	assert.Assert(t, err != nil)
+}